@@ -1,27 +1,54 @@
 package main
 
 import (
-	"encoding/json"
 	"log"
+	"time"
+
+	"common/api"
+	"common/capture"
+	"common/clock"
+	"common/config"
+	"common/health"
+	"common/metrics"
+	"common/middleware"
+	"common/shutdown"
+	"common/transport"
 
 	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
 )
 
 func main() {
+	def := config.Defaults()
+	def.ProbeInterval = 200 * time.Millisecond
+	cfg, err := config.Load(def)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	n := maelstrom.NewNode()
-	n.Handle(
+	hd := health.New(n, clock.Real(), cfg.ProbeInterval, cfg.ProbeTimeout, cfg.PhiThreshold)
+	if err := transport.FromEnv(n); err != nil {
+		log.Fatal(err)
+	}
+	capture.FromEnv(n)
+	m := metrics.New(n)
+	defer shutdown.Run()
+	shutdown.Defer(m.Dump)
+	mux := middleware.FromEnv(n)
+	shutdown.Defer(mux.Flush)
+	mux.Handle("metrics", m.Handle)
+	mux.Handle("probe", hd.HandleProbe)
+	mux.Handle("peers", hd.HandlePeers)
+	api.Handle(mux,
 		"echo",
-		func(msg maelstrom.Message) error {
-			var body map[string]any
-			if err := json.Unmarshal(msg.Body, &body); err != nil {
-				return err
-			}
-
-			body["type"] = "echo_ok"
-
-			return n.Reply(msg, body)
+		func(msg maelstrom.Message, body api.Echo) error {
+			replyBody := api.EchoOK{
+				Type: "echo_ok",
+				Echo: body.Echo}
+			return n.Reply(msg, replyBody)
 		})
 
+	hd.Start()
 	if err := n.Run(); err != nil {
 		log.Fatal(err)
 	}
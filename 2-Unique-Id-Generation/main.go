@@ -1,57 +1,182 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
-	"math/rand/v2"
-	"time"
+	"strconv"
+	"sync"
+
+	"common/api"
+	"common/capture"
+	"common/clock"
+	"common/config"
+	"common/ids"
+	"common/metrics"
+	"common/middleware"
+	"common/shutdown"
+	"common/transport"
 
 	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
 )
 
+type state struct {
+	node    *maelstrom.Node
+	cfg     config.Config
+	clock   clock.Clock
+	metrics *metrics.Registry
+	// format -> generator, created on first use as the node number is only
+	// known after init
+	gens   map[ids.Format]ids.Generator
+	gensMx sync.Mutex
+}
+
+const denseKey = "dense_id_next"
+
 func main() {
-	n := maelstrom.NewNode()
-	n.Handle(
-		"generate",
-		func(msg maelstrom.Message) error {
-			var body map[string]any
-			if err := json.Unmarshal(msg.Body, &body); err != nil {
-				return err
-			}
-
-			body["type"] = "generate_ok"
-			body["id"] = getUUID()
-
-			return n.Reply(msg, body)
-		})
-
-	if err := n.Run(); err != nil {
+	cfg, err := config.Load(config.Defaults())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := state{
+		node:  maelstrom.NewNode(),
+		cfg:   cfg,
+		clock: clock.Real(),
+		gens:  make(map[ids.Format]ids.Generator)}
+
+	if err := transport.FromEnv(s.node); err != nil {
+		log.Fatal(err)
+	}
+	capture.FromEnv(s.node)
+	s.metrics = metrics.New(s.node)
+	defer shutdown.Run()
+	shutdown.Defer(s.metrics.Dump)
+	mux := middleware.FromEnv(s.node)
+	shutdown.Defer(mux.Flush)
+
+	mux.Handle("metrics", s.metrics.Handle)
+	api.Handle(mux, "generate", s.handleGenerate)
+	api.Handle(mux, "generate_batch", s.handleGenerateBatch)
+	api.Handle(mux, "inspect_id", s.handleInspectID)
+
+	if err := s.node.Run(); err != nil {
 		log.Fatal(err)
 	}
 }
 
-const (
-	randMax1 = 1 << 12
-	randMax2 = 1 << 14
-	randMax3 = 1 << 48
-)
+func (s *state) handleGenerate(msg maelstrom.Message, body api.Generate) error {
+	gen, err := s.generator(body.Format)
+	if err != nil {
+		return err
+	}
+
+	id, err := gen.Next()
+	if err != nil {
+		return maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable, err.Error())
+	}
+
+	replyBody := api.GenerateOK{
+		Type: "generate_ok",
+		ID:   idValue(id)}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *state) handleGenerateBatch(msg maelstrom.Message, body api.GenerateBatch) error {
+	gen, err := s.generator(body.Format)
+	if err != nil {
+		return err
+	}
 
-func getUUID() string {
-	now := time.Now().UnixMilli()
-	now1 := now >> 16
-	now2 := now & 0xffff
+	batch, err := gen.NextN(*body.Count)
+	if err != nil {
+		return maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable, err.Error())
+	}
+
+	values := make([]any, len(batch))
+	for i, id := range batch {
+		values[i] = idValue(id)
+	}
+
+	replyBody := api.GenerateBatchOK{
+		Type: "generate_batch_ok",
+		IDs:  values}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *state) handleInspectID(msg maelstrom.Message, body api.InspectID) error {
+	format := ids.Format(body.Format)
+	var id string
+	switch v := body.ID.(type) {
+	case string:
+		id = v
+	case float64:
+		if format == "" {
+			format = ids.FormatDense
+		}
+		id = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	info, err := ids.Inspect(format, id)
+	if err != nil {
+		return maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
+	}
+
+	replyBody := api.InspectIDOK{
+		Type:       "inspect_id_ok",
+		Format:     string(info.Format),
+		WellFormed: info.Problem == "",
+		Problem:    info.Problem,
+		Counter:    strconv.FormatUint(info.Counter, 10)}
+	if !info.Time.IsZero() {
+		ms := info.Time.UnixMilli()
+		replyBody.Timestamp = &ms
+	}
+	if info.Node >= 0 {
+		node := fmt.Sprintf("n%d", info.Node)
+		replyBody.Node = &node
+	}
+	if info.Format == ids.FormatUUIDv7 || info.Format == ids.FormatFastUUIDv7 {
+		replyBody.Version = &info.Version
+		replyBody.Variant = &info.Variant
+	}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *state) generator(format string) (ids.Generator, error) {
+	f := ids.Format(format)
+	if f == "" {
+		f = ids.FormatUUIDv7
+	}
 
-	rand1 := rand.IntN(randMax1)
-	version := 0x7
-	rand1 = version<<12 + rand1
+	s.gensMx.Lock()
+	defer s.gensMx.Unlock()
 
-	rand2 := rand.IntN(randMax2)
-	variant := 0b10
-	rand2 = variant<<14 + rand2
+	if gen, ok := s.gens[f]; ok {
+		return gen, nil
+	}
 
-	rand3 := rand.IntN(randMax3)
+	var gen ids.Generator
+	if f == ids.FormatDense {
+		kv := maelstrom.NewLinKV(s.node)
+		gen = ids.Untyped[ids.Dense](ids.NewDense(kv, denseKey, s.cfg.IDBlockSize, s.clock, s.cfg.KVTimeout))
+	} else {
+		node, err := ids.NodeNumber(s.node.ID())
+		if err == nil {
+			gen, err = ids.NewGenerator(f, s.clock, node)
+		}
+		if err != nil {
+			return nil, maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
+		}
+	}
+	s.gens[f] = gen
+	return gen, nil
+}
 
-	uuid := fmt.Sprintf("%08x-%04x-%04x-%04x-%012x", now1, now2, rand1, rand2, rand3)
-	return uuid
+// idValue is how an ID goes into a reply, dense IDs as numbers and the rest
+// in their textual form.
+func idValue(id ids.ID) any {
+	if dense, ok := id.(ids.Dense); ok {
+		return int64(dense)
+	}
+	return id.String()
 }
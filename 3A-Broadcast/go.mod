@@ -2,4 +2,9 @@ module 3A-Broadcast
 
 go 1.24.6
 
-require github.com/jepsen-io/maelstrom/demo/go v0.0.0-20250806145204-447d18a7c07e
+require (
+	common v0.0.0
+	github.com/jepsen-io/maelstrom/demo/go v0.0.0-20250806145204-447d18a7c07e
+)
+
+replace common => ../common
@@ -1,57 +1,61 @@
 package main
 
 import (
-	"encoding/json"
 	"log"
 
+	"common/api"
+	"common/capture"
+	"common/clock"
+	"common/history"
+	"common/metrics"
+	"common/middleware"
+	"common/shutdown"
+	"common/transport"
+
 	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
 )
 
 func main() {
 	n := maelstrom.NewNode()
+	if err := transport.FromEnv(n); err != nil {
+		log.Fatal(err)
+	}
+	capture.FromEnv(n)
+	m := metrics.New(n)
+	defer shutdown.Run()
+	shutdown.Defer(m.Dump)
+	h := history.FromEnv(n, clock.Real())
+	shutdown.Defer(h.Close)
+	mux := middleware.FromEnv(n)
+	shutdown.Defer(mux.Flush)
+	mux.Handle("metrics", m.Handle)
 	var vals []float64
 
-	n.Handle(
+	api.Handle(mux,
 		"broadcast",
-		func(msg maelstrom.Message) error {
-			var body map[string]any
-			if err := json.Unmarshal(msg.Body, &body); err != nil {
-				return err
-			}
-
-			vals = append(vals, body["message"].(float64))
-			delete(body, "message")
-			body["type"] = "broadcast_ok"
+		func(msg maelstrom.Message, body api.Broadcast) error {
+			vals = append(vals, body.Values()...)
 
-			return n.Reply(msg, body)
+			replyBody := api.BroadcastOK{
+				Type: "broadcast_ok"}
+			return n.Reply(msg, replyBody)
 		})
 
-	n.Handle(
+	api.Handle(mux,
 		"read",
-		func(msg maelstrom.Message) error {
-			var body map[string]any
-			if err := json.Unmarshal(msg.Body, &body); err != nil {
-				return err
-			}
-
-			body["type"] = "read_ok"
-			body["messages"] = vals
-
-			return n.Reply(msg, body)
+		func(msg maelstrom.Message, body api.Read) error {
+			replyBody := api.ReadOK{
+				Type:     "read_ok",
+				Messages: vals}
+			return n.Reply(msg, replyBody)
 		})
 
-	n.Handle(
+	api.Handle(mux,
 		"topology",
-		func(msg maelstrom.Message) error {
-			var body map[string]any
-			if err := json.Unmarshal(msg.Body, &body); err != nil {
-				return err
-			}
-
-			body["type"] = "topology_ok"
-			delete(body, "topology")
-
-			return n.Reply(msg, body)
+		func(msg maelstrom.Message, body api.Topology) error {
+			replyBody := api.TopologyOK{
+				Type: "topology_ok"}
+			return n.Reply(msg, replyBody)
 		})
 
 	if err := n.Run(); err != nil {
@@ -1,17 +1,29 @@
 package main
 
 import (
-	"encoding/json"
 	"log"
 	"maps"
 	"slices"
 	"sync"
 
+	"common/api"
+	"common/capture"
+	"common/clock"
+	"common/history"
+	"common/metrics"
+	"common/middleware"
+	"common/shutdown"
+	"common/trace"
+	"common/transport"
+
 	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
 )
 
 type state struct {
 	node      *maelstrom.Node
+	metrics   *metrics.Registry
+	history   *history.Recorder
+	tracer    *trace.Tracer
 	values    map[float64]struct{}
 	valuesMx  sync.Mutex
 	neighbors []string
@@ -22,73 +34,73 @@ func main() {
 		node:   maelstrom.NewNode(),
 		values: make(map[float64]struct{})}
 
-	s.node.Handle("broadcast", s.handleBroadcast)
-	s.node.Handle("read", s.handleRead)
-	s.node.Handle("topology", s.handleTopology)
+	if err := transport.FromEnv(s.node); err != nil {
+		log.Fatal(err)
+	}
+	capture.FromEnv(s.node)
+	s.metrics = metrics.New(s.node)
+	defer shutdown.Run()
+	shutdown.Defer(s.metrics.Dump)
+	s.history = history.FromEnv(s.node, clock.Real())
+	shutdown.Defer(s.history.Close)
+	s.tracer = trace.FromEnv(s.node)
+	mux := middleware.FromEnv(s.node)
+	shutdown.Defer(mux.Flush)
+	mux.Use(s.tracer.Middleware())
+
+	mux.Handle("metrics", s.metrics.Handle)
+	api.Handle(mux, "broadcast", s.handleBroadcast)
+	api.Handle(mux, "read", s.handleRead)
+	api.Handle(mux, "topology", s.handleTopology)
 
 	if err := s.node.Run(); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func (s *state) handleBroadcast(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
+func (s *state) handleBroadcast(msg maelstrom.Message, body api.Broadcast) error {
+	traceCtx := s.tracer.Context(msg)
 
 	s.valuesMx.Lock()
-	value := body["message"].(float64)
-	if _, ok := s.values[value]; !ok {
-		s.values[value] = struct{}{}
-
+	isNew := false
+	for _, value := range body.Values() {
+		if _, ok := s.values[value]; !ok {
+			s.values[value] = struct{}{}
+			isNew = true
+		}
+	}
+	if isNew {
 		go func() {
 			for _, id := range s.neighbors {
 				if id != msg.Src {
-					s.node.Send(id, body)
+					s.tracer.Send(traceCtx, id, body)
 				}
 			}
 		}()
 	}
 	s.valuesMx.Unlock()
 
-	replyBody := map[string]any{
-		"type": "broadcast_ok"}
+	replyBody := api.BroadcastOK{
+		Type: "broadcast_ok"}
 	return s.node.Reply(msg, replyBody)
 }
 
-func (s *state) handleRead(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-
+func (s *state) handleRead(msg maelstrom.Message, body api.Read) error {
 	s.valuesMx.Lock()
 	values := slices.Collect(maps.Keys(s.values))
 	s.valuesMx.Unlock()
 
-	replyBody := map[string]any{
-		"type":     "read_ok",
-		"messages": values}
+	replyBody := api.ReadOK{
+		Type:     "read_ok",
+		Messages: values}
 	return s.node.Reply(msg, replyBody)
 }
 
-func (s *state) handleTopology(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-
-	ids := body["topology"].(map[string]any)
+func (s *state) handleTopology(msg maelstrom.Message, body api.Topology) error {
 	ownId := s.node.ID()
+	s.neighbors = body.Topology[ownId]
 
-	neighborsRaw := ids[ownId].([]any)
-	s.neighbors = make([]string, 0, len(neighborsRaw))
-	for _, node := range neighborsRaw {
-		s.neighbors = append(s.neighbors, node.(string))
-	}
-
-	replyBody := map[string]any{
-		"type": "topology_ok"}
+	replyBody := api.TopologyOK{
+		Type: "topology_ok"}
 	return s.node.Reply(msg, replyBody)
 }
@@ -0,0 +1,154 @@
+// Package broadcast is the node of challenge #3c: values are sent to the
+// neighbors once and repaired by anti-entropy, or gossiped instead.
+package broadcast
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"common/antientropy"
+	"common/api"
+	"common/clock"
+	"common/config"
+	"common/gossip"
+	"common/metrics"
+	"common/topology"
+	"common/trace"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+type Server struct {
+	node        *maelstrom.Node
+	cfg         config.Config
+	clock       clock.Clock
+	metrics     *metrics.Registry
+	tracer      *trace.Tracer
+	values      *antientropy.Set
+	syncer      *antientropy.Syncer
+	topology    topology.Strategy
+	neighbors   []string
+	neighborsMx sync.Mutex
+	// nil unless gossiping instead of following the topology
+	gossip *gossip.Gossiper
+}
+
+// Defaults returns the configuration of #3c, before any overrides.
+func Defaults() config.Config {
+	def := config.Defaults()
+	// values are sent once, with no budget on messages repair can be eager
+	def.AntiEntropyInterval = 500 * time.Millisecond
+	return def
+}
+
+// New returns the server of n. Its handlers still have to be registered
+// and its loops started.
+func New(n *maelstrom.Node, clk clock.Clock, cfg config.Config, m *metrics.Registry, tracer *trace.Tracer) (*Server, error) {
+	strategy, err := topology.New(cfg.Topology, cfg.CentralNode, cfg.TreeFanout, cfg.RingChords)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		node:     n,
+		cfg:      cfg,
+		clock:    clk,
+		metrics:  m,
+		tracer:   tracer,
+		topology: strategy,
+		values:   antientropy.NewSet()}
+	s.syncer = antientropy.New(s.node, s.clock, s.values, s.cfg.AntiEntropyInterval, s.syncPeers)
+	if s.cfg.GossipInterval > 0 {
+		// gossip pulls take the place of the anti-entropy rounds
+		s.gossip = gossip.New(s.node, s.clock, s.values, s.syncer, s.cfg.GossipInterval, s.cfg.GossipFanout, s.cfg.GossipPushRatio)
+		s.metrics.Gauge("gossip_rounds", s.gossip.Rounds)
+	}
+	return s, nil
+}
+
+// Register registers the handlers of the server with r.
+func (s *Server) Register(r api.Registrar) {
+	r.Handle("sync", s.syncer.HandleSync)
+	r.Handle("sync_values", s.syncer.HandleValues)
+	if s.gossip != nil {
+		r.Handle("gossip", s.gossip.HandleGossip)
+	}
+	api.Handle(r, "broadcast", s.handleBroadcast)
+	api.Handle(r, "read", s.handleRead)
+	api.Handle(r, "topology", s.handleTopology)
+}
+
+// Start starts gossiping, or the anti-entropy rounds, until Stop is called.
+func (s *Server) Start() {
+	if s.gossip != nil {
+		s.gossip.Start()
+	} else {
+		s.syncer.Start()
+	}
+}
+
+// Stop ends the loops started by Start.
+func (s *Server) Stop() {
+	if s.gossip != nil {
+		s.gossip.Stop()
+	} else {
+		s.syncer.Stop()
+	}
+}
+
+func (s *Server) handleBroadcast(msg maelstrom.Message, body api.Broadcast) error {
+	traceCtx := s.tracer.Context(msg)
+	if s.gossip != nil {
+		for _, value := range body.Values() {
+			s.gossip.Add(value)
+		}
+	} else if len(s.values.AddAll(body.Values())) > 0 {
+		// sent once, whatever gets lost is repaired by anti-entropy
+		for _, id := range s.neighborIDs() {
+			if id != msg.Src {
+				go func() {
+					ctx, cancel := s.clock.WithDeadline(traceCtx, s.clock.Now().Add(s.cfg.RPCTimeout))
+					defer cancel()
+					_, err := s.tracer.SyncRPC(ctx, id, body)
+					s.metrics.RPCError(err)
+				}()
+			}
+		}
+	}
+
+	replyBody := api.BroadcastOK{
+		Type: "broadcast_ok"}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *Server) handleRead(msg maelstrom.Message, body api.Read) error {
+	replyBody := api.ReadOK{
+		Type:     "read_ok",
+		Messages: s.values.Values()}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *Server) handleTopology(msg maelstrom.Message, body api.Topology) error {
+	neighbors := s.topology(s.node.ID(), s.node.NodeIDs(), body.Topology)
+	s.neighborsMx.Lock()
+	s.neighbors = neighbors
+	s.neighborsMx.Unlock()
+
+	replyBody := api.TopologyOK{
+		Type: "topology_ok"}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *Server) syncPeers() []string {
+	return s.neighborIDs()
+}
+
+// neighborIDs returns a copy of the neighbors set by the last topology
+// message, which may come in at any time.
+func (s *Server) neighborIDs() []string {
+	s.neighborsMx.Lock()
+	defer s.neighborsMx.Unlock()
+
+	return slices.Clone(s.neighbors)
+}
@@ -0,0 +1,89 @@
+//go:build go1.25
+
+package broadcast
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"common/checker"
+	"common/config"
+	"common/metrics"
+	"common/sim"
+	"common/trace"
+	"common/workload"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// run broadcasts and reads at the rate of the challenge while n1 is cut off
+// from 2s to 6s, and checks that every node ends up with every value.
+func run(t *testing.T, cfg config.Config) {
+	synctest.Test(t, func(t *testing.T) {
+		nw := sim.New(sim.Config{
+			Seed:    1,
+			Latency: sim.Latency{Base: 10 * time.Millisecond, Jitter: 10 * time.Millisecond},
+			Wait:    synctest.Wait})
+		var servers []*Server
+		for i := range 5 {
+			n := maelstrom.NewNode()
+			s, err := New(n, nw.Clock(), cfg, metrics.New(n), trace.New(n, ""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Register(n)
+			nw.AddNode(fmt.Sprintf("n%d", i), n)
+			servers = append(servers, s)
+		}
+		if err := nw.Start(); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range servers {
+			s.Start()
+		}
+
+		start := nw.Now()
+		nw.At(start+2*time.Second, func(nw *sim.Network) {
+			nw.Isolate("n1")
+		})
+		nw.At(start+6*time.Second, (*sim.Network).Heal)
+		h, err := workload.Broadcast{
+			Ops:       100,
+			Interval:  100 * time.Millisecond,
+			FinalWait: 3 * time.Second,
+			Seed:      1}.Run(nw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res := checker.CheckBroadcast(h); !res.Valid {
+			t.Errorf("lost %v, unexpected %v", res.Lost, res.Unexpected)
+		}
+
+		for _, s := range servers {
+			s.Stop()
+		}
+		nw.Drain()
+		nw.Close()
+	})
+}
+
+func TestPartition(t *testing.T) {
+	run(t, Defaults())
+}
+
+func TestGossipPartition(t *testing.T) {
+	cfg := Defaults()
+	cfg.GossipInterval = 250 * time.Millisecond
+	run(t, cfg)
+}
@@ -0,0 +1,245 @@
+// Package broadcast is the node of challenge #3d: values go around a star
+// by default, with a single attempt per message and anti-entropy behind
+// it, or through gossip or Plumtree instead.
+package broadcast
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"common/antientropy"
+	"common/api"
+	"common/clock"
+	"common/config"
+	"common/gossip"
+	"common/health"
+	"common/metrics"
+	"common/plumtree"
+	"common/topology"
+	"common/trace"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+type Server struct {
+	node        *maelstrom.Node
+	cfg         config.Config
+	clock       clock.Clock
+	metrics     *metrics.Registry
+	tracer      *trace.Tracer
+	health      *health.Detector
+	values      *antientropy.Set
+	syncer      *antientropy.Syncer
+	topology    topology.Strategy
+	neighbors   []string
+	neighborsMx sync.Mutex
+	// nil unless gossiping instead of following the topology
+	gossip *gossip.Gossiper
+	// nil unless running Plumtree over the topology
+	plumtree *plumtree.Tree
+	// nil unless the topology is a star and the node neither gossips nor
+	// runs Plumtree
+	hub *topology.Hub
+}
+
+// Defaults returns the configuration of #3d, before any overrides.
+func Defaults() config.Config {
+	def := config.Defaults()
+	def.Topology = topology.Star
+	return def
+}
+
+// New returns the server of n. Its handlers still have to be registered
+// and its loops started.
+func New(n *maelstrom.Node, clk clock.Clock, cfg config.Config, m *metrics.Registry, tracer *trace.Tracer) (*Server, error) {
+	strategy, err := topology.New(cfg.Topology, cfg.CentralNode, cfg.TreeFanout, cfg.RingChords)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		node:     n,
+		cfg:      cfg,
+		clock:    clk,
+		metrics:  m,
+		tracer:   tracer,
+		topology: strategy,
+		values:   antientropy.NewSet()}
+	s.health = health.New(s.node, s.clock, s.cfg.ProbeInterval, s.cfg.ProbeTimeout, s.cfg.PhiThreshold)
+	if s.cfg.Topology == topology.Star && s.cfg.GossipInterval == 0 && s.cfg.PlumtreeInterval == 0 {
+		s.hub = topology.NewHub(s.node, s.clock, s.health, s.cfg.CentralNode, s.cfg.HubFailures, s.cfg.HubRecheck)
+	}
+	s.syncer = antientropy.New(s.node, s.clock, s.values, s.cfg.AntiEntropyInterval, s.syncPeers)
+	if s.cfg.GossipInterval > 0 {
+		// gossip pulls take the place of the anti-entropy rounds
+		s.gossip = gossip.New(s.node, s.clock, s.values, s.syncer, s.cfg.GossipInterval, s.cfg.GossipFanout, s.cfg.GossipPushRatio)
+		s.metrics.Gauge("gossip_rounds", s.gossip.Rounds)
+	}
+	if s.cfg.PlumtreeInterval > 0 {
+		s.plumtree = plumtree.New(s.node, s.clock, s.values, s.cfg.PlumtreeInterval, s.cfg.GraftTimeout, s.treePeers)
+		s.metrics.Gauge("plumtree_lazy_peers", s.plumtree.Lazy)
+	}
+	return s, nil
+}
+
+// Register registers the handlers of the server with r.
+func (s *Server) Register(r api.Registrar) {
+	r.Handle("probe", s.health.HandleProbe)
+	r.Handle("peers", s.health.HandlePeers)
+	r.Handle("sync", s.syncer.HandleSync)
+	r.Handle("sync_values", s.syncer.HandleValues)
+	if s.gossip != nil {
+		r.Handle("gossip", s.gossip.HandleGossip)
+	}
+	if s.plumtree != nil {
+		r.Handle("push", s.plumtree.HandlePush)
+		r.Handle("prune", s.plumtree.HandlePrune)
+		r.Handle("ihave", s.plumtree.HandleIHave)
+		r.Handle("graft", s.plumtree.HandleGraft)
+	}
+	api.Handle(r, "broadcast", s.handleBroadcast)
+	api.Handle(r, "read", s.handleRead)
+	api.Handle(r, "topology", s.handleTopology)
+}
+
+// Start starts the probes, the hub tracker, gossiping or the anti-entropy
+// rounds and Plumtree, until Stop is called.
+func (s *Server) Start() {
+	s.health.Start()
+	if s.hub != nil {
+		s.hub.Start()
+	}
+	if s.gossip != nil {
+		s.gossip.Start()
+	} else {
+		s.syncer.Start()
+	}
+	if s.plumtree != nil {
+		s.plumtree.Start()
+	}
+}
+
+// Stop ends the loops started by Start.
+func (s *Server) Stop() {
+	s.health.Stop()
+	if s.hub != nil {
+		s.hub.Stop()
+	}
+	if s.gossip != nil {
+		s.gossip.Stop()
+	} else {
+		s.syncer.Stop()
+	}
+	if s.plumtree != nil {
+		s.plumtree.Stop()
+	}
+}
+
+func (s *Server) handleBroadcast(msg maelstrom.Message, body api.Broadcast) error {
+	traceCtx := s.tracer.Context(msg)
+	switch {
+	case s.gossip != nil:
+		for _, value := range body.Values() {
+			s.gossip.Add(value)
+		}
+	case s.plumtree != nil:
+		for _, value := range body.Values() {
+			s.plumtree.Broadcast(value)
+		}
+	// anti-entropy may have brought the values before the request to relay
+	// them, which has to be followed all the same
+	case len(s.values.AddAll(body.Values())) > 0 || body.Relay:
+		peers, toHub := s.route(msg.Src, body.Relay)
+		body.Relay = false
+		for _, id := range peers {
+			go s.send(traceCtx, id, body)
+		}
+		if toHub {
+			body.Relay = true
+			go s.send(traceCtx, s.hub.Current(), body)
+		}
+	}
+
+	replyBody := api.BroadcastOK{
+		Type: "broadcast_ok"}
+	return s.node.Reply(msg, replyBody)
+}
+
+// route returns the nodes a new value from src goes to, or, in the star
+// topology, whether it goes to the hub instead. A node relays the values
+// other nodes send to it as their hub, and the ones of its clients while
+// it's the hub itself. Nodes the failure detector suspects are skipped,
+// anti-entropy brings them the values once they're back.
+func (s *Server) route(src string, relay bool) ([]string, bool) {
+	if s.hub == nil {
+		return s.health.Alive(slices.DeleteFunc(s.neighborIDs(), func(id string) bool {
+			return id == src
+		})), false
+	}
+
+	fromClient := !slices.Contains(s.node.NodeIDs(), src)
+	if relay || fromClient && s.hub.Current() == s.node.ID() {
+		return s.health.Alive(slices.DeleteFunc(slices.Clone(s.node.NodeIDs()), func(id string) bool {
+			return id == src || id == s.node.ID()
+		})), false
+	}
+	return nil, fromClient
+}
+
+// send passes body on to id in a single attempt, whatever gets lost is
+// repaired by anti-entropy.
+func (s *Server) send(traceCtx context.Context, id string, body api.Broadcast) {
+	ctx, cancel := s.clock.WithDeadline(traceCtx, s.clock.Now().Add(s.cfg.RetryBase))
+	defer cancel()
+	sent := s.clock.Now()
+	_, err := s.tracer.SyncRPC(ctx, id, body)
+	if s.hub != nil {
+		s.hub.Observe(id, sent, err)
+	}
+	s.metrics.RPCError(err)
+}
+
+// syncPeers returns the nodes to compare values with: the hub in the star,
+// which leaves it to the other nodes itself, the neighbors otherwise.
+func (s *Server) syncPeers() []string {
+	if s.hub == nil {
+		return s.neighborIDs()
+	}
+	if hub := s.hub.Current(); hub != s.node.ID() {
+		return []string{hub}
+	}
+	return nil
+}
+
+// treePeers returns the nodes Plumtree builds its tree out of.
+func (s *Server) treePeers() []string {
+	return s.neighborIDs()
+}
+
+func (s *Server) handleRead(msg maelstrom.Message, body api.Read) error {
+	replyBody := api.ReadOK{
+		Type:     "read_ok",
+		Messages: s.values.Values()}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *Server) handleTopology(msg maelstrom.Message, body api.Topology) error {
+	neighbors := s.topology(s.node.ID(), s.node.NodeIDs(), body.Topology)
+	s.neighborsMx.Lock()
+	s.neighbors = neighbors
+	s.neighborsMx.Unlock()
+
+	replyBody := api.TopologyOK{
+		Type: "topology_ok"}
+	return s.node.Reply(msg, replyBody)
+}
+
+// neighborIDs returns a copy of the neighbors set by the last topology
+// message, which may come in at any time.
+func (s *Server) neighborIDs() []string {
+	s.neighborsMx.Lock()
+	defer s.neighborsMx.Unlock()
+
+	return slices.Clone(s.neighbors)
+}
@@ -0,0 +1,318 @@
+// Package broadcast is the node of challenge #3e: values are batched every
+// broadcast interval and retried until they get through, around a star by
+// default.
+package broadcast
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"common/api"
+	"common/clock"
+	"common/config"
+	"common/health"
+	"common/metrics"
+	"common/topology"
+	"common/trace"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+type Server struct {
+	node    *maelstrom.Node
+	cfg     config.Config
+	clock   clock.Clock
+	metrics *metrics.Registry
+	tracer  *trace.Tracer
+	health  *health.Detector
+	// set of received values
+	values   map[float64]struct{}
+	valuesMx sync.Mutex
+	// buffer for resending values, src -> values,
+	// so as to not pollute the nw with duplicates
+	valuesBuf map[string][]float64
+	// spans of the broadcasts the buffered values came in, src -> spans
+	valuesBufLinks map[string][]trace.SpanContext
+	valuesBufMx    sync.Mutex
+	topology       topology.Strategy
+	neighbors      []string
+	neighborsMx    sync.Mutex
+	// nil unless the topology is a star
+	hub *topology.Hub
+	// closed by Stop
+	stop chan struct{}
+}
+
+// Defaults returns the configuration of #3e, before any overrides.
+func Defaults() config.Config {
+	def := config.Defaults()
+	def.Topology = topology.Star
+	return def
+}
+
+// New returns the server of n. Its handlers still have to be registered
+// and its loops started.
+func New(n *maelstrom.Node, clk clock.Clock, cfg config.Config, m *metrics.Registry, tracer *trace.Tracer) (*Server, error) {
+	strategy, err := topology.New(cfg.Topology, cfg.CentralNode, cfg.TreeFanout, cfg.RingChords)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		node:           n,
+		cfg:            cfg,
+		clock:          clk,
+		metrics:        m,
+		tracer:         tracer,
+		topology:       strategy,
+		values:         make(map[float64]struct{}),
+		valuesBuf:      make(map[string][]float64),
+		valuesBufLinks: make(map[string][]trace.SpanContext),
+		stop:           make(chan struct{})}
+	s.metrics.Gauge("values_buf", s.valuesBufLen)
+	s.health = health.New(s.node, s.clock, s.cfg.ProbeInterval, s.cfg.ProbeTimeout, s.cfg.PhiThreshold)
+	if s.cfg.Topology == topology.Star {
+		s.hub = topology.NewHub(s.node, s.clock, s.health, s.cfg.CentralNode, s.cfg.HubFailures, s.cfg.HubRecheck)
+	}
+	return s, nil
+}
+
+// Register registers the handlers of the server with r.
+func (s *Server) Register(r api.Registrar) {
+	r.Handle("probe", s.health.HandleProbe)
+	r.Handle("peers", s.health.HandlePeers)
+	api.Handle(r, "broadcast", s.handleBroadcast)
+	api.Handle(r, "read", s.handleRead)
+	api.Handle(r, "topology", s.handleTopology)
+}
+
+// Start starts the probes, the hub tracker and the batches until Stop is
+// called. Batches already sent are retried until they get through.
+func (s *Server) Start() {
+	s.health.Start()
+	if s.hub != nil {
+		s.hub.Start()
+	}
+	go s.broadcastLoop()
+}
+
+// Stop ends the loops started by Start.
+func (s *Server) Stop() {
+	s.health.Stop()
+	if s.hub != nil {
+		s.hub.Stop()
+	}
+	close(s.stop)
+}
+
+func (s *Server) handleBroadcast(msg maelstrom.Message, body api.Broadcast) error {
+	traceCtx := s.tracer.Context(msg)
+	var values []float64
+
+	s.valuesMx.Lock()
+	for _, value := range body.Values() {
+		if _, ok := s.values[value]; !ok {
+			s.values[value] = struct{}{}
+			values = append(values, value)
+		}
+	}
+	s.valuesMx.Unlock()
+
+	// in the star, only the values sent to this node as the hub go on
+	if s.hub != nil && !body.Relay && slices.Contains(s.node.NodeIDs(), msg.Src) {
+		values = nil
+	}
+
+	s.valuesBufMx.Lock()
+	src := msg.Src
+	if valuesBuf, ok := s.valuesBuf[src]; ok {
+		s.valuesBuf[src] = append(valuesBuf, values...)
+	} else {
+		s.valuesBuf[src] = values
+	}
+	if span, ok := trace.SpanFromContext(traceCtx); ok && len(values) > 0 {
+		s.valuesBufLinks[src] = append(s.valuesBufLinks[src], span)
+	}
+	s.valuesBufMx.Unlock()
+
+	replyBody := api.BroadcastOK{
+		Type: "broadcast_ok"}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *Server) handleRead(msg maelstrom.Message, body api.Read) error {
+	s.valuesMx.Lock()
+	values := slices.Collect(maps.Keys(s.values))
+	s.valuesMx.Unlock()
+
+	replyBody := api.ReadOK{
+		Type:     "read_ok",
+		Messages: values}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *Server) handleTopology(msg maelstrom.Message, body api.Topology) error {
+	neighbors := s.topology(s.node.ID(), s.node.NodeIDs(), body.Topology)
+	s.neighborsMx.Lock()
+	s.neighbors = neighbors
+	s.neighborsMx.Unlock()
+
+	replyBody := api.TopologyOK{
+		Type: "topology_ok"}
+	return s.node.Reply(msg, replyBody)
+}
+
+// neighborIDs returns a copy of the neighbors set by the last topology
+// message, which may come in at any time.
+func (s *Server) neighborIDs() []string {
+	s.neighborsMx.Lock()
+	defer s.neighborsMx.Unlock()
+
+	return slices.Clone(s.neighbors)
+}
+
+func (s *Server) broadcastLoop() {
+	ticker := s.clock.NewTicker(s.cfg.BroadcastInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C():
+		}
+
+		s.valuesBufMx.Lock()
+		if len(s.valuesBuf) > 0 {
+			valuesBufTmp := make(map[string][]float64)
+			for src, values := range s.valuesBuf {
+				valuesTmp := make([]float64, len(values))
+				copy(valuesTmp, values)
+				valuesBufTmp[src] = valuesTmp
+			}
+
+			linksTmp := s.valuesBufLinks
+
+			s.valuesBuf = make(map[string][]float64)
+			s.valuesBufLinks = make(map[string][]trace.SpanContext)
+			s.valuesBufMx.Unlock()
+
+			if s.hub == nil {
+				for _, id := range s.neighborIDs() {
+					go s.broadcast(func() string { return id }, valuesBufTmp, linksTmp, false)
+				}
+			} else {
+				s.flushStar(valuesBufTmp, linksTmp)
+			}
+		} else {
+			s.valuesBufMx.Unlock()
+		}
+	}
+}
+
+// flushStar relays the values other nodes sent to this node as their hub,
+// and the ones of clients while it's the hub itself, to all the other
+// nodes, and passes the rest of the values of clients on to the hub.
+func (s *Server) flushStar(valuesFromSrcs map[string][]float64, linksFromSrcs map[string][]trace.SpanContext) {
+	self := s.node.ID()
+	isHub := s.hub.Current() == self
+	toAll := make(map[string][]float64)
+	toHub := make(map[string][]float64)
+	for src, values := range valuesFromSrcs {
+		if isHub || slices.Contains(s.node.NodeIDs(), src) {
+			toAll[src] = values
+		} else {
+			toHub[src] = values
+		}
+	}
+
+	for _, id := range s.node.NodeIDs() {
+		if id != self {
+			go s.broadcast(func() string { return id }, toAll, linksFromSrcs, false)
+		}
+	}
+	go s.broadcast(s.hub.Current, toHub, linksFromSrcs, true)
+}
+
+// broadcast retries sending the values until they're acknowledged by dest,
+// which is asked for the destination before every attempt. Values that
+// came from the destination are left out.
+func (s *Server) broadcast(dest func() string, valuesFromSrcs map[string][]float64, linksFromSrcs map[string][]trace.SpanContext, relay bool) {
+	dst := dest()
+	messages := []float64{}
+	var links []trace.SpanContext
+	for src, values := range valuesFromSrcs {
+		if dst != src {
+			messages = append(messages, values...)
+			links = append(links, linksFromSrcs[src]...)
+		}
+	}
+
+	if len(messages) == 0 {
+		return
+	}
+
+	traceCtx, end := s.tracer.Start(context.Background(), "broadcast batch", links...)
+	defer end()
+
+	body := api.Broadcast{
+		MessageBody: maelstrom.MessageBody{Type: "broadcast"},
+		Messages:    messages,
+		Relay:       relay}
+
+	timeout := s.cfg.RetryBase
+	for {
+		if dst == s.node.ID() {
+			// this node took over as the hub, so it relays the values itself
+			for _, id := range s.node.NodeIDs() {
+				if id != dst {
+					go s.broadcast(func() string { return id }, valuesFromSrcs, linksFromSrcs, false)
+				}
+			}
+			return
+		}
+
+		// a destination the failure detector suspects isn't sent to, the
+		// attempt is waited out as if it timed out
+		if s.health.Suspected(dst) {
+			<-s.clock.After(timeout)
+		} else {
+			timeLimit :=
+				s.clock.Now().Add(timeout)
+			ctx, cancel :=
+				s.clock.WithDeadline(traceCtx, timeLimit)
+			defer cancel()
+			sent := s.clock.Now()
+			_, err := s.tracer.SyncRPC(ctx, dst, body)
+			if s.hub != nil {
+				s.hub.Observe(dst, sent, err)
+			}
+			if s.metrics.RPCError(err) == nil {
+				break
+			}
+			s.metrics.Inc(metrics.Retries)
+			timeout *= time.Duration(s.cfg.RetryFactor)
+		}
+
+		// a new hub gets a fresh timeout
+		if next := dest(); next != dst {
+			dst = next
+			timeout = s.cfg.RetryBase
+		}
+	}
+}
+
+func (s *Server) valuesBufLen() int {
+	s.valuesBufMx.Lock()
+	defer s.valuesBufMx.Unlock()
+
+	size := 0
+	for _, values := range s.valuesBuf {
+		size += len(values)
+	}
+	return size
+}
+
+// rwmutex maybe?
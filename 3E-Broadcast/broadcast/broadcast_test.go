@@ -0,0 +1,132 @@
+//go:build go1.25
+
+package broadcast
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"common/checker"
+	"common/config"
+	"common/metrics"
+	"common/sim"
+	"common/topology"
+	"common/trace"
+	"common/workload"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// cluster starts count servers on nw.
+func cluster(t *testing.T, nw *sim.Network, cfg config.Config, count int) []*Server {
+	var servers []*Server
+	for i := range count {
+		n := maelstrom.NewNode()
+		s, err := New(n, nw.Clock(), cfg, metrics.New(n), trace.New(n, ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Register(n)
+		nw.AddNode(fmt.Sprintf("n%d", i), n)
+		servers = append(servers, s)
+	}
+	if err := nw.Start(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range servers {
+		s.Start()
+	}
+	return servers
+}
+
+// shutdown stops the servers and lets their last messages and deadlines
+// run out, so that the nodes return from Run.
+func shutdown(nw *sim.Network, servers []*Server) {
+	for _, s := range servers {
+		s.Stop()
+	}
+	nw.Heal()
+	nw.Drain()
+	nw.Close()
+}
+
+// partition broadcasts and reads on 5 nodes while n0, the hub of the star,
+// is cut off from 2s to 6s, and checks that every node ends up with every
+// value. The batches sent meanwhile are retried until they get through.
+func partition(t *testing.T, cfg config.Config) {
+	synctest.Test(t, func(t *testing.T) {
+		nw := sim.New(sim.Config{
+			Seed:    1,
+			Latency: sim.Latency{Base: 10 * time.Millisecond, Jitter: 10 * time.Millisecond},
+			Wait:    synctest.Wait})
+		servers := cluster(t, nw, cfg, 5)
+
+		start := nw.Now()
+		nw.At(start+2*time.Second, func(nw *sim.Network) {
+			nw.Isolate("n0")
+		})
+		nw.At(start+6*time.Second, (*sim.Network).Heal)
+		h, err := workload.Broadcast{
+			Ops:       100,
+			Interval:  100 * time.Millisecond,
+			FinalWait: 3 * time.Second,
+			Seed:      1}.Run(nw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res := checker.CheckBroadcast(h); !res.Valid {
+			t.Errorf("lost %v, unexpected %v", res.Lost, res.Unexpected)
+		}
+
+		shutdown(nw, servers)
+	})
+}
+
+func TestStarPartition(t *testing.T) {
+	partition(t, Defaults())
+}
+
+func TestGridPartition(t *testing.T) {
+	cfg := Defaults()
+	cfg.Topology = topology.Maelstrom
+	partition(t, cfg)
+}
+
+// TestTargets runs the workload of the challenge, 25 nodes with 100ms of
+// latency and 100 operations a second, and checks msgs-per-op and the
+// median and max latency against the targets.
+func TestTargets(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		nw := sim.New(sim.Config{
+			Seed:    1,
+			Latency: sim.Latency{Base: 100 * time.Millisecond},
+			Wait:    synctest.Wait})
+		servers := cluster(t, nw, Defaults(), 25)
+		h, err := workload.Broadcast{
+			Ops:       2000,
+			Interval:  10 * time.Millisecond,
+			FinalWait: 3 * time.Second,
+			Seed:      1}.Run(nw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := checker.CheckBroadcast(h)
+		t.Logf("msgs-per-op %.2f, median %s, max %s", res.MsgsPerOp, res.StableLatency.Median, res.StableLatency.Max)
+		if err := res.Check(checker.Targets3E); err != nil {
+			t.Error(err)
+		}
+
+		shutdown(nw, servers)
+	})
+}
@@ -2,4 +2,9 @@ module 4-Grow-Only-Counter
 
 go 1.24.6
 
-require github.com/jepsen-io/maelstrom/demo/go v0.0.0-20251128144731-cb7f07239012
+require (
+	common v0.0.0
+	github.com/jepsen-io/maelstrom/demo/go v0.0.0-20251128144731-cb7f07239012
+)
+
+replace common => ../common
@@ -1,45 +1,82 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
 	"log"
-	"time"
+
+	"common/api"
+	"common/capture"
+	"common/clock"
+	"common/config"
+	"common/history"
+	"common/metrics"
+	"common/middleware"
+	"common/shutdown"
+	"common/trace"
+	"common/transport"
 
 	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
 )
 
 type state struct {
 	node           *maelstrom.Node
-	kv             *maelstrom.KV
+	cfg            config.Config
+	clock          clock.Clock
+	metrics        *metrics.Registry
+	history        *history.Recorder
+	tracer         *trace.Tracer
+	kv             *trace.KV
 	global_counter int
 	own_counter    int
 }
 
 func main() {
+	cfg, err := config.Load(config.Defaults())
+	if err != nil {
+		panic(err)
+	}
+
 	s := state{
-		node: maelstrom.NewNode()}
-	s.kv = maelstrom.NewSeqKV(s.node)
+		node:  maelstrom.NewNode(),
+		cfg:   cfg,
+		clock: clock.Real()}
 
-	s.node.Handle("read", s.handleRead)
-	s.node.Handle("add", s.handleAdd)
+	if err := transport.FromEnv(s.node); err != nil {
+		panic(err)
+	}
+	capture.FromEnv(s.node)
+	s.metrics = metrics.New(s.node)
+	defer shutdown.Run()
+	shutdown.Defer(s.metrics.Dump)
+	s.history = history.FromEnv(s.node, s.clock)
+	shutdown.Defer(s.history.Close)
+	s.tracer = trace.FromEnv(s.node)
+	s.kv = s.tracer.KV(maelstrom.SeqKV)
+	mux := middleware.FromEnv(s.node)
+	shutdown.Defer(mux.Flush)
+	mux.Use(s.tracer.Middleware())
+
+	mux.Handle("metrics", s.metrics.Handle)
+	api.Handle(mux, "read", s.handleRead)
+	api.Handle(mux, "add", s.handleAdd)
 
 	if err := s.node.Run(); err != nil {
 		panic(err)
 	}
 }
 
-func (s *state) handleRead(msg maelstrom.Message) error {
+func (s *state) handleRead(msg maelstrom.Message, body api.Read) error {
+	traceCtx := s.tracer.Context(msg)
 	for {
-		ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+		ctx, cancel := s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 		defer cancel()
 		err := s.kv.Write(ctx, s.node.ID(), s.own_counter)
 		if err != nil {
+			s.metrics.RPCError(err)
 			log.Println(err.Error())
 		}
 		s.own_counter += 1
 
-		ctx, cancel = context.WithTimeout(context.Background(), 1000*time.Millisecond)
+		ctx, cancel = s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 		defer cancel()
 		global_counter, err := s.kv.Read(ctx, "counter")
 
@@ -51,33 +88,35 @@ func (s *state) handleRead(msg maelstrom.Message) error {
 			s.global_counter = 0
 			break
 		} else {
+			s.metrics.RPCError(err)
 			log.Println(err.Error())
 		}
 	}
 
-	replyBody := map[string]any{
-		"type":  "read_ok",
-		"value": s.global_counter}
+	replyBody := api.ReadValueOK{
+		Type:  "read_ok",
+		Value: s.global_counter}
 	return s.node.Reply(msg, replyBody)
 }
 
-func (s *state) handleAdd(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-	delta := int(body["delta"].(float64))
+func (s *state) handleAdd(msg maelstrom.Message, body api.Add) error {
+	traceCtx := s.tracer.Context(msg)
+	delta := *body.Delta
 
 	for {
-		ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+		ctx, cancel := s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 		defer cancel()
 		err := s.kv.CompareAndSwap(ctx, "counter", s.global_counter, s.global_counter+delta, true)
 		if err != nil {
-			ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+			s.metrics.CASError(err)
+			s.metrics.RPCError(err)
+
+			ctx, cancel := s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 			defer cancel()
 			global_counter, err := s.kv.Read(ctx, "counter")
 
 			if err != nil {
+				s.metrics.RPCError(err)
 				log.Println(err)
 			}
 
@@ -87,7 +126,7 @@ func (s *state) handleAdd(msg maelstrom.Message) error {
 		}
 	}
 
-	replyBody := map[string]any{
-		"type": "add_ok"}
+	replyBody := api.AddOK{
+		Type: "add_ok"}
 	return s.node.Reply(msg, replyBody)
 }
@@ -1,14 +1,24 @@
 package main
 
 import (
-	"encoding/json"
 	"sync"
 
+	"common/api"
+	"common/capture"
+	"common/clock"
+	"common/history"
+	"common/metrics"
+	"common/middleware"
+	"common/shutdown"
+	"common/transport"
+
 	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
 )
 
 type state struct {
 	node                *maelstrom.Node
+	metrics             *metrics.Registry
+	history             *history.Recorder
 	logs                map[string][]float64
 	committed_offsets   map[string]int
 	logsMx              sync.Mutex
@@ -21,23 +31,32 @@ func main() {
 		logs:              make(map[string][]float64),
 		committed_offsets: make(map[string]int)}
 
-	s.node.Handle("send", s.handleSend)
-	s.node.Handle("poll", s.handlePoll)
-	s.node.Handle("commit_offsets", s.handleCommitOffsets)
-	s.node.Handle("list_committed_offsets", s.handleListCommittedOffsets)
+	if err := transport.FromEnv(s.node); err != nil {
+		panic(err)
+	}
+	capture.FromEnv(s.node)
+	s.metrics = metrics.New(s.node)
+	defer shutdown.Run()
+	shutdown.Defer(s.metrics.Dump)
+	s.history = history.FromEnv(s.node, clock.Real())
+	shutdown.Defer(s.history.Close)
+	mux := middleware.FromEnv(s.node)
+	shutdown.Defer(mux.Flush)
+
+	mux.Handle("metrics", s.metrics.Handle)
+	api.Handle(mux, "send", s.handleSend)
+	api.Handle(mux, "poll", s.handlePoll)
+	api.Handle(mux, "commit_offsets", s.handleCommitOffsets)
+	api.Handle(mux, "list_committed_offsets", s.handleListCommittedOffsets)
 
 	if err := s.node.Run(); err != nil {
 		panic(err)
 	}
 }
 
-func (s *state) handleSend(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-	key := body["key"].(string)
-	val := body["msg"].(float64)
+func (s *state) handleSend(msg maelstrom.Message, body api.Send) error {
+	key := body.Key
+	val := *body.Msg
 
 	var offset int
 	s.logsMx.Lock()
@@ -50,24 +69,17 @@ func (s *state) handleSend(msg maelstrom.Message) error {
 	}
 	s.logsMx.Unlock()
 
-	replyBody := map[string]any{
-		"type":   "send_ok",
-		"offset": offset}
+	replyBody := api.SendOK{
+		Type:   "send_ok",
+		Offset: offset}
 	return s.node.Reply(msg, replyBody)
 }
 
-func (s *state) handlePoll(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-	offsets := body["offsets"].(map[string]any)
-
+func (s *state) handlePoll(msg maelstrom.Message, body api.Poll) error {
 	msgs := make(map[string][][]float64)
 	s.logsMx.Lock()
-	for key, offsetRaw := range offsets {
-		offset := int(offsetRaw.(float64))
-		keyMsgs := s.logs[key][offset:len(s.logs[key])]
+	for key, offset := range body.Offsets {
+		keyMsgs := s.logs[key][min(offset, len(s.logs[key])):len(s.logs[key])]
 
 		offsetMsgPairs := [][]float64{}
 		for index, msg := range keyMsgs {
@@ -79,49 +91,35 @@ func (s *state) handlePoll(msg maelstrom.Message) error {
 	}
 	s.logsMx.Unlock()
 
-	replyBody := map[string]any{
-		"type": "poll_ok",
-		"msgs": msgs}
+	replyBody := api.PollOK{
+		Type: "poll_ok",
+		Msgs: msgs}
 	return s.node.Reply(msg, replyBody)
 }
 
-func (s *state) handleCommitOffsets(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-	offsets := body["offsets"].(map[string]any)
-
+func (s *state) handleCommitOffsets(msg maelstrom.Message, body api.CommitOffsets) error {
 	s.committed_offsetsMx.Lock()
-	for key, offsetRaw := range offsets {
-		offset := int(offsetRaw.(float64))
+	for key, offset := range body.Offsets {
 		s.committed_offsets[key] = offset
 	}
 	s.committed_offsetsMx.Unlock()
 
-	replyBody := map[string]any{
-		"type": "commit_offsets_ok"}
+	replyBody := api.CommitOffsetsOK{
+		Type: "commit_offsets_ok"}
 	return s.node.Reply(msg, replyBody)
 }
 
-func (s *state) handleListCommittedOffsets(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-	keys := body["keys"].([]any)
-
+func (s *state) handleListCommittedOffsets(msg maelstrom.Message, body api.ListCommittedOffsets) error {
 	offsets := make(map[string]int)
 
 	s.committed_offsetsMx.Lock()
-	for _, keyRaw := range keys {
-		key := keyRaw.(string)
+	for _, key := range body.Keys {
 		offsets[key] = s.committed_offsets[key]
 	}
 	s.committed_offsetsMx.Unlock()
 
-	replyBody := map[string]any{
-		"type":    "list_committed_offsets_ok",
-		"offsets": offsets}
+	replyBody := api.ListCommittedOffsetsOK{
+		Type:    "list_committed_offsets_ok",
+		Offsets: offsets}
 	return s.node.Reply(msg, replyBody)
 }
@@ -1,90 +1,117 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
 	"log"
-	"time"
+
+	"common/api"
+	"common/capture"
+	"common/clock"
+	"common/config"
+	"common/history"
+	"common/metrics"
+	"common/middleware"
+	"common/shutdown"
+	"common/trace"
+	"common/transport"
 
 	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
 )
 
 type state struct {
-	node *maelstrom.Node
-	kv   *maelstrom.KV
+	node    *maelstrom.Node
+	cfg     config.Config
+	clock   clock.Clock
+	metrics *metrics.Registry
+	history *history.Recorder
+	tracer  *trace.Tracer
+	kv      *trace.KV
 }
 
 func main() {
+	cfg, err := config.Load(config.Defaults())
+	if err != nil {
+		panic(err)
+	}
+
 	s := state{
-		node: maelstrom.NewNode()}
-	s.kv = maelstrom.NewLinKV(s.node)
+		node:  maelstrom.NewNode(),
+		cfg:   cfg,
+		clock: clock.Real()}
 
-	s.node.Handle("send", s.handleSend)
-	s.node.Handle("poll", s.handlePoll)
-	s.node.Handle("commit_offsets", s.handleCommitOffsets)
-	s.node.Handle("list_committed_offsets", s.handleListCommittedOffsets)
+	if err := transport.FromEnv(s.node); err != nil {
+		panic(err)
+	}
+	capture.FromEnv(s.node)
+	s.metrics = metrics.New(s.node)
+	defer shutdown.Run()
+	shutdown.Defer(s.metrics.Dump)
+	s.history = history.FromEnv(s.node, s.clock)
+	shutdown.Defer(s.history.Close)
+	s.tracer = trace.FromEnv(s.node)
+	s.kv = s.tracer.KV(maelstrom.LinKV)
+	mux := middleware.FromEnv(s.node)
+	shutdown.Defer(mux.Flush)
+	mux.Use(s.tracer.Middleware())
+
+	mux.Handle("metrics", s.metrics.Handle)
+	api.Handle(mux, "send", s.handleSend)
+	api.Handle(mux, "poll", s.handlePoll)
+	api.Handle(mux, "commit_offsets", s.handleCommitOffsets)
+	api.Handle(mux, "list_committed_offsets", s.handleListCommittedOffsets)
 
 	if err := s.node.Run(); err != nil {
 		panic(err)
 	}
 }
 
-func (s *state) handleSend(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-	key := body["key"].(string)
-	val := body["msg"].(float64)
+func (s *state) handleSend(msg maelstrom.Message, body api.Send) error {
+	traceCtx := s.tracer.Context(msg)
+	key := body.Key
+	val := *body.Msg
 
 	var offset int
 	for {
-		ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+		ctx, cancel := s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 		defer cancel()
 		valsRaw, err := s.kv.Read(ctx, key)
 
 		if maelstrom.ErrorCode(err) == maelstrom.KeyDoesNotExist {
 			valsNew := []float64{val}
 
-			ctx, cancel = context.WithTimeout(context.Background(), 1000*time.Millisecond)
+			ctx, cancel = s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 			defer cancel()
 			err := s.kv.CompareAndSwap(ctx, key, nil, valsNew, true)
 			if err == nil {
 				offset = 0
 				break
 			}
+			s.metrics.CASError(err)
 		} else if err == nil {
 			valsOld := valsRaw.([]any)
 			valsNew := append(valsOld, val)
 
-			ctx, cancel = context.WithTimeout(context.Background(), 1000*time.Millisecond)
+			ctx, cancel = s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 			defer cancel()
 			err := s.kv.CompareAndSwap(ctx, key, valsOld, valsNew, false)
 			if err == nil {
 				offset = len(valsOld)
 				break
 			}
+			s.metrics.CASError(err)
 		}
 	}
 
-	replyBody := map[string]any{
-		"type":   "send_ok",
-		"offset": offset}
+	replyBody := api.SendOK{
+		Type:   "send_ok",
+		Offset: offset}
 	return s.node.Reply(msg, replyBody)
 }
 
-func (s *state) handlePoll(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-	offsets := body["offsets"].(map[string]any)
-
+func (s *state) handlePoll(msg maelstrom.Message, body api.Poll) error {
+	traceCtx := s.tracer.Context(msg)
 	msgs := make(map[string][][]float64)
-	for key, offsetRaw := range offsets {
-		offset := int(offsetRaw.(float64))
-
-		ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	for key, offset := range body.Offsets {
+		ctx, cancel := s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 		defer cancel()
 		valsRaw, err := s.kv.Read(ctx, key)
 
@@ -92,7 +119,7 @@ func (s *state) handlePoll(msg maelstrom.Message) error {
 		if err == nil {
 			vals := valsRaw.([]any)
 
-			keyMsgs := vals[offset:]
+			keyMsgs := vals[min(offset, len(vals)):]
 
 			for index, msgRaw := range keyMsgs {
 				msg := msgRaw.(float64)
@@ -104,56 +131,46 @@ func (s *state) handlePoll(msg maelstrom.Message) error {
 		msgs[key] = offsetMsgPairs
 	}
 
-	replyBody := map[string]any{
-		"type": "poll_ok",
-		"msgs": msgs}
+	replyBody := api.PollOK{
+		Type: "poll_ok",
+		Msgs: msgs}
 	return s.node.Reply(msg, replyBody)
 }
 
-func (s *state) handleCommitOffsets(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-	offsets := body["offsets"].(map[string]any)
-
-	for key, offsetRaw := range offsets {
+func (s *state) handleCommitOffsets(msg maelstrom.Message, body api.CommitOffsets) error {
+	traceCtx := s.tracer.Context(msg)
+	for key, offset := range body.Offsets {
 		key += "_commited"
-		offset := int(offsetRaw.(float64))
 
-		ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+		ctx, cancel := s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 		defer cancel()
 		_, err := s.kv.Read(ctx, key)
 
 		if maelstrom.ErrorCode(err) == maelstrom.KeyDoesNotExist {
-			ctx, cancel = context.WithTimeout(context.Background(), 1000*time.Millisecond)
+			ctx, cancel = s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 			defer cancel()
 
 			err := s.kv.CompareAndSwap(ctx, key, nil, offset, true)
-			if err != nil && maelstrom.ErrorCode(err) != maelstrom.KeyDoesNotExist {
-				log.Println(err.Error())
+			if err != nil {
+				s.metrics.CASError(err)
+				if maelstrom.ErrorCode(err) != maelstrom.KeyDoesNotExist {
+					log.Println(err.Error())
+				}
 			}
 		}
 	}
 
-	replyBody := map[string]any{
-		"type": "commit_offsets_ok"}
+	replyBody := api.CommitOffsetsOK{
+		Type: "commit_offsets_ok"}
 	return s.node.Reply(msg, replyBody)
 }
 
-func (s *state) handleListCommittedOffsets(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-	keys := body["keys"].([]any)
-
+func (s *state) handleListCommittedOffsets(msg maelstrom.Message, body api.ListCommittedOffsets) error {
+	traceCtx := s.tracer.Context(msg)
 	offsets := make(map[string]int)
 
-	for _, keyRaw := range keys {
-		key := keyRaw.(string)
-
-		ctx, cancel := context.WithTimeout(context.Background(), 1000*time.Millisecond)
+	for _, key := range body.Keys {
+		ctx, cancel := s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 		defer cancel()
 		offsetRaw, err := s.kv.Read(ctx, key + "_commited")
 
@@ -165,8 +182,8 @@ func (s *state) handleListCommittedOffsets(msg maelstrom.Message) error {
 		}
 	}
 
-	replyBody := map[string]any{
-		"type":    "list_committed_offsets_ok",
-		"offsets": offsets}
+	replyBody := api.ListCommittedOffsetsOK{
+		Type:    "list_committed_offsets_ok",
+		Offsets: offsets}
 	return s.node.Reply(msg, replyBody)
 }
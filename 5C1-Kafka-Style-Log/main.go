@@ -1,45 +1,81 @@
 package main
 
 import (
-	"context"
-	"encoding/json"
 	"log"
 	"sync"
 	"time"
 
+	"common/api"
+	"common/capture"
+	"common/clock"
+	"common/config"
+	"common/history"
+	"common/metrics"
+	"common/middleware"
+	"common/shutdown"
+	"common/trace"
+	"common/transport"
+
 	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
 )
 
 type state struct {
 	node          *maelstrom.Node
-	kv            *maelstrom.KV
+	cfg           config.Config
+	clock         clock.Clock
+	metrics       *metrics.Registry
+	history       *history.Recorder
+	tracer        *trace.Tracer
+	kv            *trace.KV
 	offsetCache   map[string][]any
 	offsetCacheMx sync.Mutex
 }
 
 func main() {
+	def := config.Defaults()
+	def.KVTimeout = 100 * time.Millisecond
+	cfg, err := config.Load(def)
+	if err != nil {
+		panic(err)
+	}
+
 	s := state{
 		node:        maelstrom.NewNode(),
+		cfg:         cfg,
+		clock:       clock.Real(),
 		offsetCache: make(map[string][]any)}
-	s.kv = maelstrom.NewLinKV(s.node)
 
-	s.node.Handle("send", s.handleSend)
-	s.node.Handle("poll", s.handlePoll)
-	s.node.Handle("commit_offsets", s.handleCommitOffsets)
-	s.node.Handle("list_committed_offsets", s.handleListCommittedOffsets)
+	if err := transport.FromEnv(s.node); err != nil {
+		panic(err)
+	}
+	capture.FromEnv(s.node)
+	s.metrics = metrics.New(s.node)
+	defer shutdown.Run()
+	shutdown.Defer(s.metrics.Dump)
+	s.history = history.FromEnv(s.node, s.clock)
+	shutdown.Defer(s.history.Close)
+	s.metrics.Gauge("offset_cache", s.offsetCacheLen)
+	s.tracer = trace.FromEnv(s.node)
+	s.kv = s.tracer.KV(maelstrom.LinKV)
+	mux := middleware.FromEnv(s.node)
+	shutdown.Defer(mux.Flush)
+	mux.Use(s.tracer.Middleware())
+
+	mux.Handle("metrics", s.metrics.Handle)
+	api.Handle(mux, "send", s.handleSend)
+	api.Handle(mux, "poll", s.handlePoll)
+	api.Handle(mux, "commit_offsets", s.handleCommitOffsets)
+	api.Handle(mux, "list_committed_offsets", s.handleListCommittedOffsets)
 
 	if err := s.node.Run(); err != nil {
 		panic(err)
 	}
 }
 
-func (s *state) handleSend(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-	key := body["key"].(string)
-	val := body["msg"].(float64)
+func (s *state) handleSend(msg maelstrom.Message, body api.Send) error {
+	traceCtx := s.tracer.Context(msg)
+	key := body.Key
+	val := *body.Msg
 
 	var offset int
 	isFromCacheSuccessful := false
@@ -57,7 +93,7 @@ func (s *state) handleSend(msg maelstrom.Message) error {
 		valsNew = []any{val}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	ctx, cancel := s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 	defer cancel()
 	err := s.kv.CompareAndSwap(ctx, key, valsOld, valsNew, true)
 
@@ -68,6 +104,8 @@ func (s *state) handleSend(msg maelstrom.Message) error {
 		s.offsetCacheMx.Lock()
 		s.offsetCache[key] = valsNew
 		s.offsetCacheMx.Unlock()
+	} else {
+		s.metrics.CASError(err)
 	}
 
 	// Then if CAS from cache fails, repeatedly make a read from kv and
@@ -76,31 +114,33 @@ func (s *state) handleSend(msg maelstrom.Message) error {
 		var valsNew []any
 
 		for {
-			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			ctx, cancel := s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 			defer cancel()
 			valsRaw, err := s.kv.Read(ctx, key)
 
 			if maelstrom.ErrorCode(err) == maelstrom.KeyDoesNotExist {
 				valsNew = []any{val}
 
-				ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+				ctx, cancel = s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 				defer cancel()
 				err := s.kv.CompareAndSwap(ctx, key, nil, valsNew, true)
 				if err == nil {
 					offset = 0
 					break
 				}
+				s.metrics.CASError(err)
 			} else if err == nil {
 				valsOld := valsRaw.([]any)
 				valsNew = append(valsOld, val)
 
-				ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+				ctx, cancel = s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 				defer cancel()
 				err := s.kv.CompareAndSwap(ctx, key, valsOld, valsNew, false)
 				if err == nil {
 					offset = len(valsOld)
 					break
 				}
+				s.metrics.CASError(err)
 			}
 		}
 
@@ -109,24 +149,17 @@ func (s *state) handleSend(msg maelstrom.Message) error {
 		s.offsetCacheMx.Unlock()
 	}
 
-	replyBody := map[string]any{
-		"type":   "send_ok",
-		"offset": offset}
+	replyBody := api.SendOK{
+		Type:   "send_ok",
+		Offset: offset}
 	return s.node.Reply(msg, replyBody)
 }
 
-func (s *state) handlePoll(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-	offsets := body["offsets"].(map[string]any)
-
+func (s *state) handlePoll(msg maelstrom.Message, body api.Poll) error {
+	traceCtx := s.tracer.Context(msg)
 	msgs := make(map[string][][]float64)
-	for key, offsetRaw := range offsets {
-		offset := int(offsetRaw.(float64))
-
-		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	for key, offset := range body.Offsets {
+		ctx, cancel := s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 		defer cancel()
 		valsRaw, err := s.kv.Read(ctx, key)
 
@@ -138,7 +171,7 @@ func (s *state) handlePoll(msg maelstrom.Message) error {
 			s.offsetCache[key] = vals
 			s.offsetCacheMx.Unlock()
 
-			keyMsgs := vals[offset:]
+			keyMsgs := vals[min(offset, len(vals)):]
 
 			for index, msgRaw := range keyMsgs {
 				msg := msgRaw.(float64)
@@ -150,23 +183,16 @@ func (s *state) handlePoll(msg maelstrom.Message) error {
 		msgs[key] = offsetMsgPairs
 	}
 
-	replyBody := map[string]any{
-		"type": "poll_ok",
-		"msgs": msgs}
+	replyBody := api.PollOK{
+		Type: "poll_ok",
+		Msgs: msgs}
 	return s.node.Reply(msg, replyBody)
 }
 
-func (s *state) handleCommitOffsets(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-	offsets := body["offsets"].(map[string]any)
-
-	for key, offsetRaw := range offsets {
-		offset := int(offsetRaw.(float64))
-
-		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+func (s *state) handleCommitOffsets(msg maelstrom.Message, body api.CommitOffsets) error {
+	traceCtx := s.tracer.Context(msg)
+	for key, offset := range body.Offsets {
+		ctx, cancel := s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 		defer cancel()
 		err := s.kv.Write(ctx, key+"_commited", offset)
 
@@ -175,24 +201,17 @@ func (s *state) handleCommitOffsets(msg maelstrom.Message) error {
 		}
 	}
 
-	replyBody := map[string]any{
-		"type": "commit_offsets_ok"}
+	replyBody := api.CommitOffsetsOK{
+		Type: "commit_offsets_ok"}
 	return s.node.Reply(msg, replyBody)
 }
 
-func (s *state) handleListCommittedOffsets(msg maelstrom.Message) error {
-	var body map[string]any
-	if err := json.Unmarshal(msg.Body, &body); err != nil {
-		return err
-	}
-	keys := body["keys"].([]any)
-
+func (s *state) handleListCommittedOffsets(msg maelstrom.Message, body api.ListCommittedOffsets) error {
+	traceCtx := s.tracer.Context(msg)
 	offsets := make(map[string]int)
 
-	for _, keyRaw := range keys {
-		key := keyRaw.(string)
-
-		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	for _, key := range body.Keys {
+		ctx, cancel := s.clock.WithTimeout(traceCtx, s.cfg.KVTimeout)
 		defer cancel()
 		offsetRaw, err := s.kv.Read(ctx, key+"_commited")
 
@@ -204,8 +223,19 @@ func (s *state) handleListCommittedOffsets(msg maelstrom.Message) error {
 		}
 	}
 
-	replyBody := map[string]any{
-		"type":    "list_committed_offsets_ok",
-		"offsets": offsets}
+	replyBody := api.ListCommittedOffsetsOK{
+		Type:    "list_committed_offsets_ok",
+		Offsets: offsets}
 	return s.node.Reply(msg, replyBody)
 }
+
+func (s *state) offsetCacheLen() int {
+	s.offsetCacheMx.Lock()
+	defer s.offsetCacheMx.Unlock()
+
+	size := 0
+	for _, vals := range s.offsetCache {
+		size += len(vals)
+	}
+	return size
+}
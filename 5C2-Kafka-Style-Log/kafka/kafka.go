@@ -0,0 +1,199 @@
+// Package kafka is the node of challenge #5c2: each key is owned by one
+// node, picked by the key modulo the number of nodes, which keeps its log
+// in lin-kv without CASes.
+package kafka
+
+import (
+	"log"
+	"strconv"
+	"sync"
+
+	"common/api"
+	"common/clock"
+	"common/config"
+	"common/health"
+	"common/metrics"
+	"common/trace"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+type Server struct {
+	node    *maelstrom.Node
+	cfg     config.Config
+	clock   clock.Clock
+	metrics *metrics.Registry
+	tracer  *trace.Tracer
+	health  *health.Detector
+	kv      *trace.KV
+	cache   map[string][]any
+	cacheMx sync.Mutex
+}
+
+// New returns the server of n. Its handlers still have to be registered
+// and its loops started.
+func New(n *maelstrom.Node, clk clock.Clock, cfg config.Config, m *metrics.Registry, tracer *trace.Tracer) *Server {
+	s := &Server{
+		node:    n,
+		cfg:     cfg,
+		clock:   clk,
+		metrics: m,
+		tracer:  tracer,
+		kv:      tracer.KV(maelstrom.LinKV),
+		cache:   make(map[string][]any)}
+	s.metrics.Gauge("cache", s.cacheLen)
+	s.health = health.New(s.node, s.clock, s.cfg.ProbeInterval, s.cfg.ProbeTimeout, s.cfg.PhiThreshold)
+	return s
+}
+
+// Register registers the handlers of the server with r.
+func (s *Server) Register(r api.Registrar) {
+	r.Handle("probe", s.health.HandleProbe)
+	r.Handle("peers", s.health.HandlePeers)
+	api.Handle(r, "send", s.handleSend)
+	api.Handle(r, "poll", s.handlePoll)
+	api.Handle(r, "commit_offsets", s.handleCommitOffsets)
+	api.Handle(r, "list_committed_offsets", s.handleListCommittedOffsets)
+}
+
+// Start starts the probes until Stop is called.
+func (s *Server) Start() {
+	s.health.Start()
+}
+
+// Stop ends the loops started by Start.
+func (s *Server) Stop() {
+	s.health.Stop()
+}
+
+func (s *Server) handleSend(msg maelstrom.Message, body api.Send) error {
+	traceCtx := s.tracer.Context(msg)
+	key := body.Key
+	keyNum, _ := strconv.Atoi(key)
+	id := keyNum % len(s.node.NodeIDs())
+
+	ownId, _ := strconv.Atoi(s.node.ID()[1:])
+
+	var offset int
+	if id == ownId {
+		val := *body.Msg
+
+		s.cacheMx.Lock()
+		var valsNew []any
+		valsOld, present := s.cache[key]
+		if present {
+			valsNew = append(valsOld, val)
+		} else {
+			valsNew = []any{val}
+		}
+		s.cache[key] = valsNew
+		s.cacheMx.Unlock()
+
+		err := s.kv.Write(traceCtx, key, valsNew)
+
+		if err != nil {
+			log.Println(err.Error())
+		}
+
+		offset = len(valsOld)
+	} else {
+		idStr := strconv.Itoa(id)
+		dst := "n" + idStr
+		if s.health.Suspected(dst) {
+			// fail fast rather than leave the client waiting for a node
+			// that's likely down
+			return maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable, dst+" owning "+key+" is suspected down")
+		}
+
+		if res, err := s.tracer.SyncRPC(traceCtx, dst, msg.Body); err == nil {
+			resBody, err := api.Decode[api.SendOK](res)
+			if err != nil {
+				return err
+			}
+			offset = resBody.Offset
+		} else {
+			s.metrics.RPCError(err)
+			log.Println(err.Error())
+		}
+	}
+
+	replyBody := api.SendOK{
+		Type:   "send_ok",
+		Offset: offset}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *Server) handlePoll(msg maelstrom.Message, body api.Poll) error {
+	traceCtx := s.tracer.Context(msg)
+	msgs := make(map[string][][]float64)
+	for key, offset := range body.Offsets {
+		valsRaw, err := s.kv.Read(traceCtx, key)
+
+		offsetMsgPairs := [][]float64{}
+		if err == nil {
+			vals := valsRaw.([]any)
+
+			keyMsgs := vals[min(offset, len(vals)):]
+
+			for index, msgRaw := range keyMsgs {
+				msg := msgRaw.(float64)
+				realOffset := float64(offset + index)
+				offsetMsgPairs = append(offsetMsgPairs, []float64{realOffset, msg})
+			}
+
+		}
+		msgs[key] = offsetMsgPairs
+	}
+
+	replyBody := api.PollOK{
+		Type: "poll_ok",
+		Msgs: msgs}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *Server) handleCommitOffsets(msg maelstrom.Message, body api.CommitOffsets) error {
+	traceCtx := s.tracer.Context(msg)
+	for key, offset := range body.Offsets {
+		err := s.kv.Write(traceCtx, key+"_commited", offset)
+
+		if err != nil {
+			log.Println(err.Error())
+		}
+	}
+
+	replyBody := api.CommitOffsetsOK{
+		Type: "commit_offsets_ok"}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *Server) handleListCommittedOffsets(msg maelstrom.Message, body api.ListCommittedOffsets) error {
+	traceCtx := s.tracer.Context(msg)
+	offsets := make(map[string]int)
+
+	for _, key := range body.Keys {
+		offsetRaw, err := s.kv.Read(traceCtx, key+"_commited")
+
+		if err == nil {
+			offset := offsetRaw.(int)
+			offsets[key] = offset
+		} else if maelstrom.ErrorCode(err) != maelstrom.KeyDoesNotExist {
+			log.Println(err.Error())
+		}
+	}
+
+	replyBody := api.ListCommittedOffsetsOK{
+		Type:    "list_committed_offsets_ok",
+		Offsets: offsets}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *Server) cacheLen() int {
+	s.cacheMx.Lock()
+	defer s.cacheMx.Unlock()
+
+	size := 0
+	for _, vals := range s.cache {
+		size += len(vals)
+	}
+	return size
+}
@@ -0,0 +1,164 @@
+//go:build go1.25
+
+package kafka
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"common/api"
+	"common/checker"
+	"common/config"
+	"common/kvstore"
+	"common/metrics"
+	"common/sim"
+	"common/trace"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// client records the operations of a sim client for CheckKafka.
+type client struct {
+	t  *testing.T
+	nw *sim.Network
+	c  *sim.Client
+	h  checker.KafkaHistory
+}
+
+func (c *client) call(op checker.KafkaOp, reqBody any) checker.KafkaOp {
+	c.t.Helper()
+
+	op.Invoke = c.nw.Now()
+	res, err := c.c.Call(op.Node, reqBody, 5*time.Second)
+	op.Complete = c.nw.Now()
+	if err != nil {
+		c.t.Fatalf("%s to %s: %s", op.F, op.Node, err)
+	}
+	op.OK = true
+	switch op.F {
+	case "send":
+		resBody, err := api.Decode[api.SendOK](res)
+		op.Offset = resBody.Offset
+		op.OK = err == nil
+	case "poll":
+		resBody, err := api.Decode[api.PollOK](res)
+		op.Msgs = resBody.Msgs
+		op.OK = err == nil
+	case "list_committed_offsets":
+		resBody, err := api.Decode[api.ListCommittedOffsetsOK](res)
+		op.Offsets = resBody.Offsets
+		op.OK = err == nil
+	}
+	c.h.Ops = append(c.h.Ops, op)
+	return op
+}
+
+func (c *client) send(node, key string, msg float64) int {
+	op := c.call(checker.KafkaOp{Node: node, F: "send", Key: key, Msg: msg}, api.Send{
+		MessageBody: maelstrom.MessageBody{Type: "send"},
+		Key:         key,
+		Msg:         &msg})
+	return op.Offset
+}
+
+func (c *client) poll(node string, offsets map[string]int) map[string][][]float64 {
+	op := c.call(checker.KafkaOp{Node: node, F: "poll", Offsets: offsets}, api.Poll{
+		MessageBody: maelstrom.MessageBody{Type: "poll"},
+		Offsets:     offsets})
+	return op.Msgs
+}
+
+// TestLog sends to keys owned by every node through every node, and checks
+// the offsets, what the nodes poll and the committed offsets.
+func TestLog(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		nw := sim.New(sim.Config{
+			Seed:    1,
+			Latency: sim.Latency{Base: 10 * time.Millisecond, Jitter: 10 * time.Millisecond},
+			Wait:    synctest.Wait})
+		kvstore.NewLinKV().Attach(nw)
+		var servers []*Server
+		for i := range 3 {
+			n := maelstrom.NewNode()
+			s := New(n, nw.Clock(), config.Defaults(), metrics.New(n), trace.New(n, ""))
+			s.Register(n)
+			nw.AddNode(fmt.Sprintf("n%d", i), n)
+			servers = append(servers, s)
+		}
+		if err := nw.Start(); err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range servers {
+			s.Start()
+		}
+
+		c := &client{t: t, nw: nw, c: nw.Client()}
+		keys := []string{"0", "1", "2", "3", "4", "5"}
+		nodes := nw.NodeIDs()
+		want := make(map[string][][]float64)
+		var msg float64
+		for round := range 4 {
+			for i, key := range keys {
+				node := nodes[(i+round)%len(nodes)]
+				offset := c.send(node, key, msg)
+				if offset != len(want[key]) {
+					t.Errorf("send of %g to %s through %s got offset %d, want %d", msg, key, node, offset, len(want[key]))
+				}
+				want[key] = append(want[key], []float64{float64(offset), msg})
+				msg++
+			}
+		}
+
+		for _, node := range nodes {
+			offsets := make(map[string]int)
+			for _, key := range keys {
+				offsets[key] = 0
+			}
+			got := c.poll(node, offsets)
+			for _, key := range keys {
+				if fmt.Sprint(got[key]) != fmt.Sprint(want[key]) {
+					t.Errorf("poll of %s from %s got %v, want %v", key, node, got[key], want[key])
+				}
+			}
+		}
+
+		// past the end of the log, which clients may well ask for
+		for _, key := range keys {
+			if got := c.poll(nodes[0], map[string]int{key: 100}); len(got[key]) != 0 {
+				t.Errorf("poll of %s past the end got %v, want nothing", key, got[key])
+			}
+		}
+
+		committed := map[string]int{"0": 2, "4": 3}
+		c.call(checker.KafkaOp{Node: "n0", F: "commit_offsets", Offsets: committed}, api.CommitOffsets{
+			MessageBody: maelstrom.MessageBody{Type: "commit_offsets"},
+			Offsets:     committed})
+		listed := c.call(checker.KafkaOp{Node: "n2", F: "list_committed_offsets"}, api.ListCommittedOffsets{
+			MessageBody: maelstrom.MessageBody{Type: "list_committed_offsets"},
+			Keys:        keys})
+		if fmt.Sprint(listed.Offsets) != fmt.Sprint(committed) {
+			t.Errorf("listed offsets %v, want %v", listed.Offsets, committed)
+		}
+
+		if res := checker.CheckKafka(c.h); !res.Valid {
+			t.Errorf("faults: %v", res.Faults)
+		}
+
+		for _, s := range servers {
+			s.Stop()
+		}
+		nw.Drain()
+		nw.Close()
+	})
+}
@@ -0,0 +1,221 @@
+// Package antientropy repairs the value sets of the broadcast nodes in the
+// background, so that a value only has to be sent to a neighbor once and
+// nothing is retried per value. Every interval a node compares the Merkle
+// tree of its set with the one of a peer, a level at a time: it sends the
+// sums of the children of the nodes that differ in a sync RPC, and the
+// peer answers with the children whose sums differ from its own. At the
+// leaves, which hardly hold a value the sets agree on, or earlier if the
+// node has no values below the differing nodes or more than MaxNodes of
+// them differ, the node sends its values below them in a sync_values RPC,
+// and the peer adds the ones it lacks and answers with only the ones the
+// node lacks. A round costs two messages if the sets agree and up to
+// 2*Depth+2 if they don't, and no message carries more than
+// MaxNodes*Fanout sums or MaxValues values, however far the sets have
+// drifted apart.
+package antientropy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"common/api"
+	"common/clock"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+type Syncer struct {
+	node  *maelstrom.Node
+	clock clock.Clock
+	set   *Set
+	// 0 disables syncing, the handlers still answer the peers
+	interval time.Duration
+	// nodes to pick the partner of a round from
+	peers func() []string
+	// closed by Stop
+	stop chan struct{}
+}
+
+const (
+	// MaxNodes is the number of nodes of a level a round descends into at
+	// most. Past that, the values below the first of them are exchanged.
+	MaxNodes = 64
+	// MaxValues is the number of values a sync_values message carries at
+	// most, the rest waits for the next rounds.
+	MaxValues = 256
+)
+
+// syncBody carries the sums of the children of nodes at level of the
+// sender's tree.
+type syncBody struct {
+	Type  string   `json:"type"`
+	Level int      `json:"level"`
+	Nodes []int    `json:"nodes"`
+	Sums  []uint32 `json:"sums"`
+}
+
+// syncOK carries the children whose sums differ.
+type syncOK struct {
+	Type  string `json:"type"`
+	Nodes []int  `json:"nodes"`
+}
+
+// valuesBody carries the values of the sender below nodes at level, the
+// answer only the ones the receiver lacks.
+type valuesBody struct {
+	Type   string    `json:"type"`
+	Level  int       `json:"level,omitempty"`
+	Nodes  []int     `json:"nodes,omitempty"`
+	Values []float64 `json:"values"`
+}
+
+// New returns a syncer repairing set against a random node out of peers
+// each interval. A round has until the next one to be answered.
+func New(n *maelstrom.Node, clk clock.Clock, set *Set, interval time.Duration, peers func() []string) *Syncer {
+	return &Syncer{
+		node:     n,
+		clock:    clk,
+		set:      set,
+		interval: interval,
+		peers:    peers,
+		stop:     make(chan struct{})}
+}
+
+// Start syncs with the peers until Stop is called, doing nothing if
+// syncing is disabled.
+func (s *Syncer) Start() {
+	if s.interval <= 0 {
+		return
+	}
+	go s.syncLoop()
+}
+
+// Stop ends the loop started by Start.
+func (s *Syncer) Stop() {
+	close(s.stop)
+}
+
+func (s *Syncer) syncLoop() {
+	ticker := s.clock.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C():
+		}
+
+		peers := s.peers()
+		if len(peers) == 0 {
+			continue
+		}
+		go func() {
+			ctx, cancel := s.clock.WithTimeout(context.Background(), s.interval)
+			defer cancel()
+			s.Sync(ctx, peers[rand.IntN(len(peers))])
+		}()
+	}
+}
+
+// Sync runs a single round with peer, which is abandoned once ctx is done.
+func (s *Syncer) Sync(ctx context.Context, peer string) {
+	level, nodes := 0, []int{0}
+	for {
+		res, err := api.SyncRPC(ctx, s.node, peer, syncBody{
+			Type:  "sync",
+			Level: level,
+			Nodes: nodes,
+			Sums:  s.set.Children(level, nodes)})
+		if err != nil {
+			return
+		}
+		var body syncOK
+		if err := json.Unmarshal(res.Body, &body); err != nil {
+			return
+		}
+		level, nodes = level+1, body.Nodes
+		if len(nodes) == 0 {
+			return
+		}
+
+		// the leaves hardly hold a value the sets agree on, so only what
+		// the peer lacks is pushed, unless there's nothing to push anyway
+		// or too much differs to descend further
+		if level == Depth || s.set.Count(level, nodes) == 0 || len(nodes) > MaxNodes {
+			break
+		}
+	}
+
+	nodes = s.set.Fit(level, nodes, MaxValues)
+	res, err := api.SyncRPC(ctx, s.node, peer, valuesBody{
+		Type:   "sync_values",
+		Level:  level,
+		Nodes:  nodes,
+		Values: s.set.Below(level, nodes, MaxValues)})
+	if err != nil {
+		return
+	}
+	var missing valuesBody
+	if err := json.Unmarshal(res.Body, &missing); err != nil {
+		return
+	}
+	s.set.AddAll(missing.Values)
+}
+
+// HandleSync answers the sums of a peer with the children that differ.
+func (s *Syncer) HandleSync(msg maelstrom.Message) error {
+	var body syncBody
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
+	}
+	if err := checkNodes(body.Level, body.Nodes, Depth-1); err != nil {
+		return err
+	}
+	if len(body.Sums) != len(body.Nodes)*Fanout {
+		return maelstrom.NewRPCError(maelstrom.MalformedRequest,
+			fmt.Sprintf("need %d sums for %d nodes, got %d", len(body.Nodes)*Fanout, len(body.Nodes), len(body.Sums)))
+	}
+
+	replyBody := syncOK{
+		Type:  "sync_ok",
+		Nodes: s.set.Diff(body.Level, body.Nodes, body.Sums)}
+	return s.node.Reply(msg, replyBody)
+}
+
+// HandleValues takes the values a peer has below the nodes that differ and
+// answers with the ones below them the peer lacks.
+func (s *Syncer) HandleValues(msg maelstrom.Message) error {
+	var body valuesBody
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
+	}
+	if err := checkNodes(body.Level, body.Nodes, Depth); err != nil {
+		return err
+	}
+
+	missing := s.set.Missing(body.Level, body.Nodes, body.Values, MaxValues)
+	s.set.AddAll(body.Values)
+	replyBody := valuesBody{
+		Type:   "sync_values_ok",
+		Values: missing}
+	return s.node.Reply(msg, replyBody)
+}
+
+// checkNodes returns a malformed-request error unless level is at most
+// maxLevel and nodes are nodes of the tree at level.
+func checkNodes(level int, nodes []int, maxLevel int) error {
+	if level < 0 || level > maxLevel {
+		return maelstrom.NewRPCError(maelstrom.MalformedRequest,
+			fmt.Sprintf("level must be between 0 and %d, got %d", maxLevel, level))
+	}
+	for _, i := range nodes {
+		if i < 0 || i >= Width(level) {
+			return maelstrom.NewRPCError(maelstrom.MalformedRequest,
+				fmt.Sprintf("no node %d at level %d", i, level))
+		}
+	}
+	return nil
+}
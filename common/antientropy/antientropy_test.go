@@ -0,0 +1,156 @@
+//go:build go1.25
+
+package antientropy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"common/sim"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// pair syncs a with b on n0 and n1 of a fresh network and records the
+// bodies of the messages between them.
+type pair struct {
+	nw      *sim.Network
+	syncers []*Syncer
+	bodies  []map[string]any
+}
+
+func newPair(t *testing.T, a, b *Set) *pair {
+	p := &pair{
+		nw: sim.New(sim.Config{
+			Seed:    1,
+			Latency: sim.Latency{Base: 10 * time.Millisecond},
+			Wait:    synctest.Wait})}
+	for i, set := range []*Set{a, b} {
+		n := maelstrom.NewNode()
+		s := New(n, p.nw.Clock(), set, 0, nil)
+		n.Handle("sync", s.HandleSync)
+		n.Handle("sync_values", s.HandleValues)
+		p.nw.AddNode([]string{"n0", "n1"}[i], n)
+		p.syncers = append(p.syncers, s)
+	}
+	if err := p.nw.Start(); err != nil {
+		t.Fatal(err)
+	}
+	p.nw.Observe(func(d sim.Delivery) {
+		var body map[string]any
+		json.Unmarshal(d.Msg.Body, &body)
+		p.bodies = append(p.bodies, body)
+	})
+	return p
+}
+
+// round runs a round of the syncer of from with the other node and
+// returns the bodies of its messages.
+func (p *pair) round(from int) []map[string]any {
+	p.bodies = nil
+	peer := []string{"n1", "n0"}[from]
+	p.nw.At(p.nw.Now(), func(nw *sim.Network) {
+		go func() {
+			ctx, cancel := nw.Clock().WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			p.syncers[from].Sync(ctx, peer)
+		}()
+	})
+	p.nw.Drain()
+	return p.bodies
+}
+
+func (p *pair) close() {
+	p.nw.Close()
+}
+
+func values(body map[string]any) []float64 {
+	var res []float64
+	for _, v := range body["values"].([]any) {
+		res = append(res, v.(float64))
+	}
+	return res
+}
+
+func TestSyncAgree(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		p := newPair(t, setOf(span(0, 1000)...), setOf(span(0, 1000)...))
+		if bodies := p.round(0); len(bodies) != 2 {
+			t.Errorf("round of equal sets took %d messages, want 2", len(bodies))
+		}
+		p.close()
+	})
+}
+
+// TestSyncMissing checks that a round exchanges the values the sets
+// differ in, and no others.
+func TestSyncMissing(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		a := setOf(span(0, 1000)...)
+		b := setOf(slices.DeleteFunc(span(0, 1000), func(v float64) bool {
+			return v == 500
+		})...)
+		b.Add(2000)
+		p := newPair(t, a, b)
+
+		bodies := p.round(0)
+		if len(bodies) > 2*Depth+2 {
+			t.Errorf("round took %d messages, want at most %d", len(bodies), 2*Depth+2)
+		}
+		for _, body := range bodies {
+			switch body["type"] {
+			case "sync_values":
+				if got := values(body); !slices.Equal(got, []float64{500}) {
+					t.Errorf("pushed %v, want [500]", got)
+				}
+			case "sync_values_ok":
+				if got := values(body); !slices.Equal(got, []float64{2000}) {
+					t.Errorf("pulled %v, want [2000]", got)
+				}
+			}
+		}
+		if !a.Has(2000) || !b.Has(500) {
+			t.Error("sets still differ")
+		}
+		p.close()
+	})
+}
+
+// TestSyncBounded repairs sets that have nothing in common, as after a
+// long partition, and checks that no message exceeds the bounds.
+func TestSyncBounded(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		a, b := setOf(span(0, 5000)...), setOf(span(5000, 10000)...)
+		p := newPair(t, a, b)
+
+		rounds := 0
+		for ; a.Len() < 10000 || b.Len() < 10000; rounds++ {
+			if rounds == 100 {
+				t.Fatalf("sets of %d and %d values after %d rounds", a.Len(), b.Len(), rounds)
+			}
+			for _, body := range p.round(rounds % 2) {
+				if sums, _ := body["sums"].([]any); len(sums) > MaxNodes*Fanout {
+					t.Fatalf("%s carries %d sums", body["type"], len(sums))
+				}
+				if values, _ := body["values"].([]any); len(values) > MaxValues {
+					t.Fatalf("%s carries %d values", body["type"], len(values))
+				}
+			}
+		}
+		t.Logf("repaired in %d rounds", rounds)
+		p.close()
+	})
+}
@@ -0,0 +1,219 @@
+package antientropy
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"sync"
+)
+
+const (
+	// Depth is the number of levels of the digest tree below its root.
+	Depth = 4
+	// Fanout is the number of children of every inner node of the tree.
+	Fanout     = 1 << fanoutBits
+	fanoutBits = 4
+)
+
+// Set is a set of broadcast values that keeps a Merkle tree of them up to
+// date: a value goes to one of the Fanout^Depth leaves by the top bits of
+// its hash, and every node of the tree sums up the values below it by the
+// sum of their hashes, so two sets differ below a node exactly when its
+// sums differ (barring collisions). The sums are 32 bits wide, so that
+// they survive JSON decoders that read numbers as float64.
+type Set struct {
+	mu     sync.Mutex
+	values map[float64]struct{}
+	// level -> node -> summary of the values below it. The root is node 0
+	// of level 0, and node i of a level is the parent of nodes i*Fanout up
+	// to i*Fanout+Fanout-1 of the next one.
+	tree [Depth + 1]map[int]summary
+}
+
+type summary struct {
+	sum   uint32
+	count int
+}
+
+func NewSet() *Set {
+	s := &Set{
+		values: make(map[float64]struct{})}
+	for level := range s.tree {
+		s.tree[level] = make(map[int]summary)
+	}
+	return s
+}
+
+// hash is a splitmix64 step on the bits of v, which, unlike the bits
+// themselves, doesn't map 0 to 0.
+func hash(v float64) uint64 {
+	x := math.Float64bits(v) + 0x9e3779b97f4a7c15
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// nodeOf returns the node at level the value of hash h belongs to.
+func nodeOf(h uint64, level int) int {
+	return int(h >> (64 - fanoutBits*level))
+}
+
+// Width returns the number of nodes at level.
+func Width(level int) int {
+	return 1 << (fanoutBits * level)
+}
+
+// Add adds v, reporting whether it's new.
+func (s *Set) Add(v float64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.add(v)
+}
+
+func (s *Set) add(v float64) bool {
+	if _, ok := s.values[v]; ok {
+		return false
+	}
+	s.values[v] = struct{}{}
+	h := hash(v)
+	for level, nodes := range s.tree {
+		i := nodeOf(h, level)
+		sm := nodes[i]
+		sm.sum += uint32(h)
+		sm.count++
+		nodes[i] = sm
+	}
+	return true
+}
+
+// AddAll adds values, returning the ones that are new.
+func (s *Set) AddAll(values []float64) []float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var added []float64
+	for _, v := range values {
+		if s.add(v) {
+			added = append(added, v)
+		}
+	}
+	return added
+}
+
+func (s *Set) Has(v float64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.values[v]
+	return ok
+}
+
+func (s *Set) Values() []float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Collect(maps.Keys(s.values))
+}
+
+func (s *Set) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.values)
+}
+
+// Children returns the sums of the children of nodes at level, Fanout of
+// them per node.
+func (s *Set) Children(level int, nodes []int) []uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sums := make([]uint32, 0, len(nodes)*Fanout)
+	for _, i := range nodes {
+		for c := range Fanout {
+			sums = append(sums, s.tree[level+1][i*Fanout+c].sum)
+		}
+	}
+	return sums
+}
+
+// Diff returns the children of nodes at level in which the set differs
+// from the one sums were taken of with Children.
+func (s *Set) Diff(level int, nodes []int, sums []uint32) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	differ := []int{}
+	for k, i := range nodes {
+		for c := range Fanout {
+			child := i*Fanout + c
+			if sums[k*Fanout+c] != s.tree[level+1][child].sum {
+				differ = append(differ, child)
+			}
+		}
+	}
+	return differ
+}
+
+// Count returns the number of values below nodes at level.
+func (s *Set) Count(level int, nodes []int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, i := range nodes {
+		count += s.tree[level][i].count
+	}
+	return count
+}
+
+// Fit returns the longest prefix of nodes at level with no more than limit
+// values below them, and at least the first node.
+func (s *Set) Fit(level int, nodes []int, limit int) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for k, i := range nodes {
+		count += s.tree[level][i].count
+		if count > limit {
+			return nodes[:max(k, 1)]
+		}
+	}
+	return nodes
+}
+
+// Below returns up to limit values below nodes at level.
+func (s *Set) Below(level int, nodes []int, limit int) []float64 {
+	return s.Missing(level, nodes, nil, limit)
+}
+
+// Missing returns up to limit values below nodes at level that aren't
+// among have.
+func (s *Set) Missing(level int, nodes []int, have []float64, limit int) []float64 {
+	in := make(map[int]bool, len(nodes))
+	for _, i := range nodes {
+		in[i] = true
+	}
+	other := make(map[float64]struct{}, len(have))
+	for _, v := range have {
+		other[v] = struct{}{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := []float64{}
+	for v := range s.values {
+		if _, ok := other[v]; !ok && in[nodeOf(hash(v), level)] {
+			res = append(res, v)
+		}
+	}
+	// the lowest ones, so that which go out doesn't depend on the map order
+	slices.Sort(res)
+	return res[:min(len(res), limit)]
+}
@@ -0,0 +1,85 @@
+package antientropy
+
+import (
+	"slices"
+	"testing"
+)
+
+func setOf(values ...float64) *Set {
+	s := NewSet()
+	s.AddAll(values)
+	return s
+}
+
+func span(from, to int) []float64 {
+	var values []float64
+	for v := from; v < to; v++ {
+		values = append(values, float64(v))
+	}
+	return values
+}
+
+// TestDiff walks the trees of two sets down to the leaves, the way a round
+// does, and checks that only the leaves of the values that differ do.
+func TestDiff(t *testing.T) {
+	a := setOf(span(0, 1000)...)
+	b := setOf(slices.DeleteFunc(span(0, 1000), func(v float64) bool {
+		return v == 500
+	})...)
+	b.Add(2000)
+
+	nodes := []int{0}
+	for level := range Depth {
+		nodes = b.Diff(level, nodes, a.Children(level, nodes))
+	}
+	want := []int{nodeOf(hash(500), Depth), nodeOf(hash(2000), Depth)}
+	slices.Sort(want)
+	if !slices.Equal(nodes, want) {
+		t.Fatalf("leaves %v differ, want %v", nodes, want)
+	}
+
+	if got := a.Missing(Depth, nodes, b.Below(Depth, nodes, MaxValues), MaxValues); !slices.Equal(got, []float64{500}) {
+		t.Errorf("b lacks %v, want [500]", got)
+	}
+	if got := b.Missing(Depth, nodes, a.Below(Depth, nodes, MaxValues), MaxValues); !slices.Equal(got, []float64{2000}) {
+		t.Errorf("a lacks %v, want [2000]", got)
+	}
+	if got := a.Diff(0, []int{0}, setOf(span(0, 1000)...).Children(0, []int{0})); len(got) != 0 {
+		t.Errorf("equal sets differ in %v", got)
+	}
+}
+
+func TestCount(t *testing.T) {
+	s := setOf(span(0, 1000)...)
+	if got := s.Count(0, []int{0}); got != 1000 {
+		t.Errorf("root counts %d values, want 1000", got)
+	}
+	for level := 1; level <= Depth; level++ {
+		count := 0
+		for i := range Width(level) {
+			count += s.Count(level, []int{i})
+		}
+		if count != 1000 {
+			t.Errorf("level %d counts %d values, want 1000", level, count)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	s := setOf(span(0, 1000)...)
+	nodes := make([]int, Width(1))
+	for i := range nodes {
+		nodes[i] = i
+	}
+
+	fit := s.Fit(1, nodes, 300)
+	if count := s.Count(1, fit); count > 300 || count+s.Count(1, nodes[len(fit):len(fit)+1]) <= 300 {
+		t.Errorf("fit %v with %d values, limit 300", fit, count)
+	}
+	if fit := s.Fit(1, nodes, 0); !slices.Equal(fit, nodes[:1]) {
+		t.Errorf("fit %v into 0 values, want the first node", fit)
+	}
+	if got := s.Below(1, nodes, 10); !slices.Equal(got, span(0, 10)) {
+		t.Errorf("below %v, want the lowest 10", got)
+	}
+}
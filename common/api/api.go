@@ -0,0 +1,47 @@
+// Package api defines typed bodies of the messages used by the challenges
+// and a way of registering handlers that receive them already decoded.
+package api
+
+import (
+	"encoding/json"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// Registrar is anything handlers can be registered with, e.g. *maelstrom.Node.
+type Registrar interface {
+	Handle(typ string, fn maelstrom.HandlerFunc)
+}
+
+// validator is implemented by requests with fields that must be present.
+type validator interface {
+	Validate() error
+}
+
+// Handle registers fn for messages of the given type. The body is decoded
+// into T before fn is called, a body that can't be decoded or doesn't pass
+// validation is answered with a malformed-request error instead.
+func Handle[T any](r Registrar, typ string, fn func(maelstrom.Message, T) error) {
+	r.Handle(typ, func(msg maelstrom.Message) error {
+		body, err := Decode[T](msg)
+		if err != nil {
+			return err
+		}
+		return fn(msg, body)
+	})
+}
+
+// Decode decodes the body of msg into T, returning a malformed-request
+// *maelstrom.RPCError on failure.
+func Decode[T any](msg maelstrom.Message) (T, error) {
+	var body T
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return body, maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
+	}
+	if v, ok := any(&body).(validator); ok {
+		if err := v.Validate(); err != nil {
+			return body, maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
+		}
+	}
+	return body, nil
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// Requests embed the reserved keys, so that they can be forwarded to other
+// nodes as they are. Responses only carry their type.
+
+type Echo struct {
+	maelstrom.MessageBody
+	Echo any `json:"echo"`
+}
+
+type EchoOK struct {
+	Type string `json:"type"`
+	Echo any    `json:"echo"`
+}
+
+type Generate struct {
+	maelstrom.MessageBody
+	// scheme of the ID, one of the formats of package ids, UUIDv7 if empty,
+	// or "dense"
+	Format string `json:"format,omitempty"`
+}
+
+type GenerateOK struct {
+	Type string `json:"type"`
+	ID   any    `json:"id"`
+}
+
+// MaxBatch is the largest count a generate_batch may ask for.
+const MaxBatch = 100000
+
+type GenerateBatch struct {
+	maelstrom.MessageBody
+	Count *int `json:"count"`
+	// same as in Generate, plus "dense" for integers leased in blocks
+	Format string `json:"format,omitempty"`
+}
+
+func (g *GenerateBatch) Validate() error {
+	if g.Count == nil {
+		return errors.New("missing count")
+	}
+	if *g.Count < 1 || *g.Count > MaxBatch {
+		return fmt.Errorf("count must be between 1 and %d", MaxBatch)
+	}
+	return nil
+}
+
+type GenerateBatchOK struct {
+	Type string `json:"type"`
+	IDs  []any  `json:"ids"`
+}
+
+// InspectID asks what an ID tells about its origin. IDs are given the way
+// generate returns them, dense ones as numbers and the rest as strings.
+type InspectID struct {
+	maelstrom.MessageBody
+	ID any `json:"id"`
+	// format of the ID, guessed if empty
+	Format string `json:"format,omitempty"`
+}
+
+func (i *InspectID) Validate() error {
+	switch i.ID.(type) {
+	case string, float64:
+		return nil
+	case nil:
+		return errors.New("missing id")
+	default:
+		return errors.New("id must be a string or a number")
+	}
+}
+
+type InspectIDOK struct {
+	Type       string `json:"type"`
+	Format     string `json:"format"`
+	WellFormed bool   `json:"well_formed"`
+	Problem    string `json:"problem,omitempty"`
+	// milliseconds since the Unix epoch
+	Timestamp *int64  `json:"timestamp,omitempty"`
+	Node      *string `json:"node,omitempty"`
+	// decimal, as it may not fit in a float64
+	Counter string `json:"counter"`
+	Version *int   `json:"version,omitempty"`
+	Variant *int   `json:"variant,omitempty"`
+}
+
+// Broadcast carries either a single value from a client or a batch of
+// values from another node.
+type Broadcast struct {
+	maelstrom.MessageBody
+	Message  *float64  `json:"message,omitempty"`
+	Messages []float64 `json:"messages,omitempty"`
+	// set by a node sending to its hub, asks the receiver to pass the
+	// values on to all the other nodes
+	Relay bool `json:"relay,omitempty"`
+}
+
+func (b *Broadcast) Validate() error {
+	if b.Message == nil && b.Messages == nil {
+		return errors.New("missing message")
+	}
+	return nil
+}
+
+// Values returns all the values carried by the broadcast.
+func (b *Broadcast) Values() []float64 {
+	if b.Message != nil {
+		return append([]float64{*b.Message}, b.Messages...)
+	}
+	return b.Messages
+}
+
+type BroadcastOK struct {
+	Type string `json:"type"`
+}
+
+type Topology struct {
+	maelstrom.MessageBody
+	Topology map[string][]string `json:"topology"`
+}
+
+func (t *Topology) Validate() error {
+	if t.Topology == nil {
+		return errors.New("missing topology")
+	}
+	return nil
+}
+
+type TopologyOK struct {
+	Type string `json:"type"`
+}
+
+type Read struct {
+	maelstrom.MessageBody
+}
+
+// ReadOK answers a broadcast read.
+type ReadOK struct {
+	Type     string    `json:"type"`
+	Messages []float64 `json:"messages"`
+}
+
+// ReadValueOK answers a counter read.
+type ReadValueOK struct {
+	Type  string `json:"type"`
+	Value int    `json:"value"`
+}
+
+type Add struct {
+	maelstrom.MessageBody
+	Delta *int `json:"delta"`
+}
+
+func (a *Add) Validate() error {
+	if a.Delta == nil {
+		return errors.New("missing delta")
+	}
+	return nil
+}
+
+type AddOK struct {
+	Type string `json:"type"`
+}
+
+type Send struct {
+	maelstrom.MessageBody
+	Key string   `json:"key"`
+	Msg *float64 `json:"msg"`
+}
+
+func (s *Send) Validate() error {
+	if s.Key == "" {
+		return errors.New("missing key")
+	}
+	if s.Msg == nil {
+		return errors.New("missing msg")
+	}
+	return nil
+}
+
+type SendOK struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+}
+
+type Poll struct {
+	maelstrom.MessageBody
+	Offsets map[string]int `json:"offsets"`
+}
+
+func (p *Poll) Validate() error {
+	if p.Offsets == nil {
+		return errors.New("missing offsets")
+	}
+	for _, offset := range p.Offsets {
+		if offset < 0 {
+			return errors.New("negative offset")
+		}
+	}
+	return nil
+}
+
+// PollOK maps keys to [offset, msg] pairs.
+type PollOK struct {
+	Type string                 `json:"type"`
+	Msgs map[string][][]float64 `json:"msgs"`
+}
+
+type CommitOffsets struct {
+	maelstrom.MessageBody
+	Offsets map[string]int `json:"offsets"`
+}
+
+func (c *CommitOffsets) Validate() error {
+	if c.Offsets == nil {
+		return errors.New("missing offsets")
+	}
+	return nil
+}
+
+type CommitOffsetsOK struct {
+	Type string `json:"type"`
+}
+
+type ListCommittedOffsets struct {
+	maelstrom.MessageBody
+	Keys []string `json:"keys"`
+}
+
+func (l *ListCommittedOffsets) Validate() error {
+	if l.Keys == nil {
+		return errors.New("missing keys")
+	}
+	return nil
+}
+
+type ListCommittedOffsetsOK struct {
+	Type    string         `json:"type"`
+	Offsets map[string]int `json:"offsets"`
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"context"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// SyncRPC is node.SyncRPC, except that a response arriving after ctx is
+// done is dropped. node.SyncRPC leaves the callback of such a response
+// blocked forever, so the node never returns from Run.
+func SyncRPC(ctx context.Context, n *maelstrom.Node, dest string, body any) (maelstrom.Message, error) {
+	respCh := make(chan maelstrom.Message, 1)
+	if err := n.RPC(dest, body, func(m maelstrom.Message) error {
+		respCh <- m
+		return nil
+	}); err != nil {
+		return maelstrom.Message{}, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return maelstrom.Message{}, ctx.Err()
+	case m := <-respCh:
+		if err := m.RPCError(); err != nil {
+			return m, err
+		}
+		return m, nil
+	}
+}
@@ -0,0 +1,127 @@
+// Package capture records the transcript of a node: every message it reads
+// and writes, in order and with the time since the node started, so that a
+// failed run can be replayed against a fresh process (see cmd/replay).
+//
+// Capturing is enabled by setting GLOMERS_CAPTURE_DIR, the transcript of
+// each node goes to <dir>/<node ID>.jsonl.
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"common/wire"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// Directions of an entry.
+const (
+	In  = "in"
+	Out = "out"
+)
+
+// Entry is a single line of a transcript.
+type Entry struct {
+	Dir string `json:"dir"`
+	// time since the capture started
+	At  time.Duration     `json:"at"`
+	Msg maelstrom.Message `json:"msg"`
+}
+
+type Capture struct {
+	dir   string
+	start time.Time
+	mu    sync.Mutex
+	file  *os.File
+	// entries seen before init told the node ID
+	early []Entry
+	// set if the file couldn't be opened, nothing more gets captured
+	openErr error
+}
+
+// FromEnv starts capturing the messages of n to GLOMERS_CAPTURE_DIR,
+// nothing happens if it's unset.
+func FromEnv(n *maelstrom.Node) *Capture {
+	return New(n, os.Getenv("GLOMERS_CAPTURE_DIR"))
+}
+
+// New captures the messages of n to <dir>/<node ID>.jsonl, disabled if dir
+// is empty. n must not be running yet.
+func New(n *maelstrom.Node, dir string) *Capture {
+	c := &Capture{
+		dir:   dir,
+		start: time.Now()}
+	if dir == "" {
+		return c
+	}
+
+	wire.OnReceive(n, func(msg maelstrom.Message) {
+		c.record(In, msg)
+	})
+	wire.OnSend(n, func(msg maelstrom.Message) {
+		c.record(Out, msg)
+	})
+	return c
+}
+
+func (c *Capture) record(dir string, msg maelstrom.Message) {
+	e := Entry{
+		Dir: dir,
+		At:  time.Since(c.start),
+		Msg: msg}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the tap sees init before the node does, so the ID is taken from it
+	if c.file == nil && c.openErr == nil && dir == In && msg.Type() == "init" {
+		var body maelstrom.InitMessageBody
+		json.Unmarshal(msg.Body, &body)
+		path := filepath.Join(c.dir, body.NodeID+".jsonl")
+		if c.file, c.openErr = os.Create(path); c.openErr != nil {
+			log.Println(c.openErr.Error())
+		}
+	}
+	if c.file == nil {
+		if c.openErr == nil {
+			c.early = append(c.early, e)
+		}
+		return
+	}
+
+	for _, e := range append(c.early, e) {
+		buf, err := json.Marshal(e)
+		if err != nil {
+			log.Println(err.Error())
+			continue
+		}
+		c.file.Write(append(buf, '\n'))
+	}
+	c.early = nil
+}
+
+// Load reads a transcript.
+func Load(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
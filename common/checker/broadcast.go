@@ -0,0 +1,195 @@
+// Package checker validates recorded histories of the challenge workloads
+// offline, without Maelstrom.
+package checker
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BroadcastOp is a completed broadcast or read operation of a client.
+type BroadcastOp struct {
+	Node string `json:"node"`
+	// "broadcast" or "read"
+	F string `json:"f"`
+	// value of a broadcast
+	Value float64 `json:"value,omitempty"`
+	// values returned by a read
+	Read     []float64     `json:"read,omitempty"`
+	Invoke   time.Duration `json:"invoke"`
+	Complete time.Duration `json:"complete"`
+	OK       bool          `json:"ok"`
+}
+
+// Message is a single message seen on the network.
+type Message struct {
+	Src  string        `json:"src"`
+	Dest string        `json:"dest"`
+	At   time.Duration `json:"at"`
+}
+
+type BroadcastHistory struct {
+	Nodes    []string      `json:"nodes"`
+	Ops      []BroadcastOp `json:"ops"`
+	Messages []Message     `json:"messages"`
+}
+
+// Targets are the limits a broadcast run has to stay within.
+type Targets struct {
+	MsgsPerOp float64
+	Median    time.Duration
+	Max       time.Duration
+}
+
+// Targets of challenges #3d and #3e.
+var (
+	Targets3D = Targets{MsgsPerOp: 30, Median: 400 * time.Millisecond, Max: 600 * time.Millisecond}
+	Targets3E = Targets{MsgsPerOp: 20, Median: time.Second, Max: 2 * time.Second}
+)
+
+type BroadcastResult struct {
+	Valid bool
+	// node -> acknowledged values missing from its final read, all of them
+	// if it has none
+	Lost map[string][]float64
+	// values read that were never broadcast
+	Unexpected []float64
+	Ops        int
+	// messages exchanged between nodes, clients and services excluded
+	ServerMessages int
+	MsgsPerOp      float64
+	// time from a broadcast invocation until the value is visible in all
+	// reads invoked after it
+	StableLatency LatencyStats
+	// values that never became stable
+	NeverStable int
+}
+
+// CheckBroadcast checks that every acknowledged broadcast ends up in the
+// final read of every node and computes the network and latency statistics.
+func CheckBroadcast(h BroadcastHistory) BroadcastResult {
+	res := BroadcastResult{
+		Lost: make(map[string][]float64),
+		Ops:  len(h.Ops)}
+
+	isNode := make(map[string]bool)
+	for _, id := range h.Nodes {
+		isNode[id] = true
+	}
+	for _, m := range h.Messages {
+		if isNode[m.Src] && isNode[m.Dest] {
+			res.ServerMessages++
+		}
+	}
+	if res.Ops > 0 {
+		res.MsgsPerOp = float64(res.ServerMessages) / float64(res.Ops)
+	}
+
+	// value -> invocation of its broadcast
+	broadcasts := make(map[float64]time.Duration)
+	acked := make(map[float64]struct{})
+	var reads []BroadcastOp
+	for _, op := range h.Ops {
+		switch op.F {
+		case "broadcast":
+			broadcasts[op.Value] = op.Invoke
+			if op.OK {
+				acked[op.Value] = struct{}{}
+			}
+		case "read":
+			if op.OK {
+				reads = append(reads, op)
+			}
+		}
+	}
+	slices.SortFunc(reads, func(a, b BroadcastOp) int {
+		return cmp.Compare(a.Invoke, b.Invoke)
+	})
+
+	// the final read of each node decides what the node ended up with
+	final := make(map[string]map[float64]struct{})
+	unexpected := make(map[float64]struct{})
+	readSets := make([]map[float64]struct{}, len(reads))
+	for i, read := range reads {
+		seen := make(map[float64]struct{}, len(read.Read))
+		for _, value := range read.Read {
+			seen[value] = struct{}{}
+			if _, ok := broadcasts[value]; !ok {
+				unexpected[value] = struct{}{}
+			}
+		}
+		readSets[i] = seen
+		final[read.Node] = seen
+	}
+	for _, node := range h.Nodes {
+		// a node without a final read lost every value
+		seen := final[node]
+		for value := range acked {
+			if _, ok := seen[value]; !ok {
+				res.Lost[node] = append(res.Lost[node], value)
+			}
+		}
+		slices.Sort(res.Lost[node])
+	}
+	for value := range unexpected {
+		res.Unexpected = append(res.Unexpected, value)
+	}
+	slices.Sort(res.Unexpected)
+
+	var latencies []time.Duration
+	for value, invoke := range broadcasts {
+		// the value is stable from the first read after the last one missing it
+		lastMiss := time.Duration(-1)
+		for i, read := range reads {
+			if _, ok := readSets[i][value]; !ok && read.Complete >= invoke {
+				lastMiss = read.Invoke
+			}
+		}
+		stable := time.Duration(-1)
+		for _, read := range reads {
+			if read.Invoke > lastMiss && read.Invoke >= invoke {
+				stable = read.Invoke
+				break
+			}
+		}
+		if stable < 0 {
+			res.NeverStable++
+			continue
+		}
+		latencies = append(latencies, stable-invoke)
+	}
+	res.StableLatency = Latencies(latencies)
+
+	res.Valid = len(res.Lost) == 0 && len(res.Unexpected) == 0
+	return res
+}
+
+// Check returns an error describing every target the result exceeds,
+// lost or unexpected values included.
+func (r BroadcastResult) Check(t Targets) error {
+	var problems []string
+	for node, lost := range r.Lost {
+		problems = append(problems, fmt.Sprintf("%s lost %d acknowledged values", node, len(lost)))
+	}
+	if len(r.Unexpected) > 0 {
+		problems = append(problems, fmt.Sprintf("%d values read but never broadcast", len(r.Unexpected)))
+	}
+	if r.MsgsPerOp >= t.MsgsPerOp {
+		problems = append(problems, fmt.Sprintf("msgs-per-op %.2f, target below %.2f", r.MsgsPerOp, t.MsgsPerOp))
+	}
+	if r.StableLatency.Median >= t.Median {
+		problems = append(problems, fmt.Sprintf("median latency %s, target below %s", r.StableLatency.Median, t.Median))
+	}
+	if r.StableLatency.Max >= t.Max {
+		problems = append(problems, fmt.Sprintf("max latency %s, target below %s", r.StableLatency.Max, t.Max))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	slices.Sort(problems)
+	return fmt.Errorf("%s", strings.Join(problems, "; "))
+}
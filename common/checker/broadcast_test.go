@@ -0,0 +1,37 @@
+package checker
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCheckBroadcastLost(t *testing.T) {
+	h := BroadcastHistory{
+		Nodes: []string{"n0", "n1", "n2"},
+		Ops: []BroadcastOp{
+			{Node: "n0", F: "broadcast", Value: 1, Invoke: 0, Complete: time.Millisecond, OK: true},
+			{Node: "n1", F: "broadcast", Value: 2, Invoke: 0, Complete: time.Millisecond, OK: true},
+			// never acknowledged, so it may go missing
+			{Node: "n1", F: "broadcast", Value: 3, Invoke: 0, Complete: time.Millisecond},
+			{Node: "n0", F: "read", Read: []float64{1, 2, 3}, Invoke: time.Second, Complete: time.Second, OK: true},
+			{Node: "n1", F: "read", Read: []float64{1}, Invoke: time.Second, Complete: time.Second, OK: true},
+			// n2 has no final read
+		}}
+
+	res := CheckBroadcast(h)
+	if res.Valid {
+		t.Fatal("valid with lost values")
+	}
+	want := map[string][]float64{
+		"n1": {2},
+		"n2": {1, 2}}
+	if len(res.Lost) != len(want) {
+		t.Fatalf("lost %v, want %v", res.Lost, want)
+	}
+	for node, lost := range want {
+		if !slices.Equal(res.Lost[node], lost) {
+			t.Errorf("%s lost %v, want %v", node, res.Lost[node], lost)
+		}
+	}
+}
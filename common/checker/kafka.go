@@ -0,0 +1,221 @@
+package checker
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// KafkaOp is a completed send, poll, commit_offsets or
+// list_committed_offsets operation of a client.
+type KafkaOp struct {
+	Node string `json:"node"`
+	F    string `json:"f"`
+	// key and msg of a send
+	Key string  `json:"key,omitempty"`
+	Msg float64 `json:"msg,omitempty"`
+	// offset assigned to a send
+	Offset int `json:"offset,omitempty"`
+	// requested offsets of a poll or commit_offsets,
+	// returned offsets of list_committed_offsets
+	Offsets map[string]int `json:"offsets,omitempty"`
+	// [offset, msg] pairs returned by a poll
+	Msgs     map[string][][]float64 `json:"msgs,omitempty"`
+	Invoke   time.Duration          `json:"invoke"`
+	Complete time.Duration          `json:"complete"`
+	OK       bool                   `json:"ok"`
+}
+
+type KafkaHistory struct {
+	Ops []KafkaOp `json:"ops"`
+}
+
+// Kinds of faults found in a kafka history.
+const (
+	DuplicateOffset = "duplicate-offset"
+	LostSend        = "lost-send"
+	PollSkip        = "poll-skip"
+	PollReorder     = "poll-reorder"
+	CommitBackwards = "commit-backwards"
+)
+
+type KafkaFault struct {
+	Kind   string
+	Key    string
+	Offset int
+	Detail string
+}
+
+func (f KafkaFault) String() string {
+	return fmt.Sprintf("%s %s@%d: %s", f.Kind, f.Key, f.Offset, f.Detail)
+}
+
+type KafkaResult struct {
+	Valid  bool
+	Faults []KafkaFault
+	// kind -> number of faults
+	Counts map[string]int
+}
+
+// CheckKafka looks for duplicate offsets within a key, acknowledged sends
+// missing from polls that cover them, polls skipping or reordering offsets
+// and committed offsets going backwards.
+func CheckKafka(h KafkaHistory) KafkaResult {
+	res := KafkaResult{
+		Counts: make(map[string]int)}
+	fault := func(kind, key string, offset int, format string, args ...any) {
+		res.Faults = append(res.Faults, KafkaFault{
+			Kind:   kind,
+			Key:    key,
+			Offset: offset,
+			Detail: fmt.Sprintf(format, args...)})
+		res.Counts[kind]++
+	}
+
+	ops := slices.Clone(h.Ops)
+	slices.SortStableFunc(ops, func(a, b KafkaOp) int {
+		return cmp.Compare(a.Invoke, b.Invoke)
+	})
+
+	// key -> offset -> msg, from both acknowledged sends and polls
+	known := make(map[string]map[int]float64)
+	observe := func(key string, offset int, msg float64, source string) {
+		if known[key] == nil {
+			known[key] = make(map[int]float64)
+		}
+		if prev, ok := known[key][offset]; ok && prev != msg {
+			fault(DuplicateOffset, key, offset, "%s has %v, already had %v", source, msg, prev)
+			return
+		}
+		known[key][offset] = msg
+	}
+
+	var sends []KafkaOp
+	for _, op := range ops {
+		if !op.OK {
+			continue
+		}
+		switch op.F {
+		case "send":
+			sends = append(sends, op)
+			observe(op.Key, op.Offset, op.Msg, "send")
+		case "poll":
+			for key, pairs := range op.Msgs {
+				for _, pair := range pairs {
+					if len(pair) == 2 {
+						observe(key, int(pair[0]), pair[1], "poll")
+					}
+				}
+			}
+		}
+	}
+
+	for _, op := range ops {
+		if !op.OK || op.F != "poll" {
+			continue
+		}
+		for key, pairs := range op.Msgs {
+			checkPoll(key, op.Offsets[key], pairs, known[key], fault)
+		}
+	}
+
+	for _, send := range sends {
+		for _, poll := range ops {
+			if !poll.OK || poll.F != "poll" || poll.Invoke < send.Complete {
+				continue
+			}
+			start, ok := poll.Offsets[send.Key]
+			if !ok || start > send.Offset {
+				continue
+			}
+			pairs := poll.Msgs[send.Key]
+			// a poll may return fewer messages, only judge those that got past the offset
+			if last := len(pairs) - 1; last >= 0 && len(pairs[last]) == 2 && int(pairs[last][0]) < send.Offset {
+				continue
+			}
+			if !containsPair(pairs, send.Offset, send.Msg) {
+				fault(LostSend, send.Key, send.Offset, "msg %v missing from a poll from offset %d", send.Msg, start)
+				break
+			}
+		}
+	}
+
+	checkCommits(ops, fault)
+
+	res.Valid = len(res.Faults) == 0
+	return res
+}
+
+type faultFunc func(kind, key string, offset int, format string, args ...any)
+
+func checkPoll(key string, start int, pairs [][]float64, known map[int]float64, fault faultFunc) {
+	prev := start - 1
+	for _, pair := range pairs {
+		if len(pair) != 2 {
+			continue
+		}
+		offset := int(pair[0])
+		if offset <= prev {
+			fault(PollReorder, key, offset, "returned after offset %d", prev)
+			continue
+		}
+		for missing := prev + 1; missing < offset; missing++ {
+			if _, ok := known[missing]; ok {
+				fault(PollSkip, key, missing, "skipped between %d and %d", prev, offset)
+			}
+		}
+		prev = offset
+	}
+}
+
+// checkCommits requires every list_committed_offsets to return at least
+// what was acknowledged as committed, or listed, before it was invoked.
+func checkCommits(ops []KafkaOp, fault faultFunc) {
+	// lowest committed offsets allowed from the time they were acknowledged
+	type floor struct {
+		key    string
+		offset int
+		at     time.Duration
+		source string
+	}
+	var floors []floor
+	for _, op := range ops {
+		if !op.OK {
+			continue
+		}
+		switch op.F {
+		case "commit_offsets":
+			for key, offset := range op.Offsets {
+				floors = append(floors, floor{key, offset, op.Complete, "commit"})
+			}
+		case "list_committed_offsets":
+			for key, offset := range op.Offsets {
+				floors = append(floors, floor{key, offset, op.Complete, "list"})
+			}
+		}
+	}
+
+	for _, op := range ops {
+		if !op.OK || op.F != "list_committed_offsets" {
+			continue
+		}
+		for key, offset := range op.Offsets {
+			for _, f := range floors {
+				if f.key == key && f.at < op.Invoke && f.offset > offset {
+					fault(CommitBackwards, key, offset, "listed after %s of offset %d", f.source, f.offset)
+					break
+				}
+			}
+		}
+	}
+}
+
+func containsPair(pairs [][]float64, offset int, msg float64) bool {
+	for _, pair := range pairs {
+		if len(pair) == 2 && int(pair[0]) == offset && pair[1] == msg {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package checker
+
+import (
+	"maps"
+	"testing"
+	"time"
+)
+
+func at(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+func send(key string, msg float64, offset, invoke int) KafkaOp {
+	return KafkaOp{Node: "n0", F: "send", Key: key, Msg: msg, Offset: offset,
+		Invoke: at(invoke), Complete: at(invoke + 1), OK: true}
+}
+
+func poll(key string, from int, msgs [][]float64, invoke int) KafkaOp {
+	return KafkaOp{Node: "n1", F: "poll", Offsets: map[string]int{key: from}, Msgs: map[string][][]float64{key: msgs},
+		Invoke: at(invoke), Complete: at(invoke + 1), OK: true}
+}
+
+func commit(key string, offset, invoke int) KafkaOp {
+	return KafkaOp{Node: "n0", F: "commit_offsets", Offsets: map[string]int{key: offset},
+		Invoke: at(invoke), Complete: at(invoke + 1), OK: true}
+}
+
+func list(key string, offset, invoke int) KafkaOp {
+	return KafkaOp{Node: "n1", F: "list_committed_offsets", Offsets: map[string]int{key: offset},
+		Invoke: at(invoke), Complete: at(invoke + 1), OK: true}
+}
+
+func TestCheckKafka(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []KafkaOp
+		// kind -> number of faults
+		want map[string]int
+	}{{
+		name: "valid",
+		ops: []KafkaOp{
+			send("k", 10, 0, 0),
+			send("k", 11, 1, 10),
+			poll("k", 0, [][]float64{{0, 10}, {1, 11}}, 20),
+			// a poll may return fewer messages than there are
+			poll("k", 0, [][]float64{{0, 10}}, 30),
+			commit("k", 1, 40),
+			list("k", 1, 50)},
+		want: map[string]int{},
+	}, {
+		name: "unacknowledged ops",
+		ops: []KafkaOp{
+			send("k", 10, 0, 0),
+			{F: "send", Key: "k", Msg: 11, Offset: 0, Invoke: at(10), Complete: at(11)},
+			poll("k", 0, [][]float64{{0, 10}}, 20)},
+		want: map[string]int{},
+	}, {
+		name: "duplicate offset",
+		ops: []KafkaOp{
+			send("k", 10, 0, 0),
+			send("k", 11, 0, 10)},
+		want: map[string]int{DuplicateOffset: 1},
+	}, {
+		name: "lost send",
+		ops: []KafkaOp{
+			send("k", 10, 0, 0),
+			send("k", 11, 1, 10),
+			poll("k", 1, [][]float64{{2, 12}}, 20)},
+		// the poll skipping offset 1 is a fault of its own
+		want: map[string]int{LostSend: 1, PollSkip: 1},
+	}, {
+		name: "poll skip",
+		ops: []KafkaOp{
+			poll("k", 0, [][]float64{{0, 10}, {1, 11}, {2, 12}}, 0),
+			poll("k", 0, [][]float64{{0, 10}, {2, 12}}, 10)},
+		want: map[string]int{PollSkip: 1},
+	}, {
+		name: "poll reorder",
+		ops: []KafkaOp{
+			poll("k", 0, [][]float64{{1, 11}, {0, 10}}, 0)},
+		// offset 0 only comes after the poll passed it
+		want: map[string]int{PollSkip: 1, PollReorder: 1},
+	}, {
+		name: "commit backwards",
+		ops: []KafkaOp{
+			commit("k", 5, 0),
+			list("k", 3, 10)},
+		want: map[string]int{CommitBackwards: 1},
+	}, {
+		name: "list backwards",
+		ops: []KafkaOp{
+			list("k", 5, 0),
+			list("k", 3, 10)},
+		want: map[string]int{CommitBackwards: 1},
+	}, {
+		// #5c2's handleSend answers with offset 0 once forwarding the send
+		// to the owner of the key fails
+		name: "5c2 send acknowledged after a failed forward",
+		ops: []KafkaOp{
+			send("k", 10, 0, 0),
+			send("k", 11, 1, 10),
+			send("k", 12, 0, 20),
+			poll("k", 0, [][]float64{{0, 10}, {1, 11}}, 30)},
+		want: map[string]int{DuplicateOffset: 1, LostSend: 1},
+	}, {
+		// #5c2's handleCommitOffsets writes the offsets blindly, so a client
+		// lagging behind takes the committed offset back
+		name: "5c2 blind commit",
+		ops: []KafkaOp{
+			commit("k", 5, 0),
+			{Node: "n2", F: "commit_offsets", Offsets: map[string]int{"k": 3}, Invoke: at(10), Complete: at(11), OK: true},
+			list("k", 3, 20)},
+		want: map[string]int{CommitBackwards: 1},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := CheckKafka(KafkaHistory{Ops: test.ops})
+			if !maps.Equal(res.Counts, test.want) {
+				t.Errorf("faults %v, want %v", res.Faults, test.want)
+			}
+			if res.Valid != (len(test.want) == 0) {
+				t.Errorf("valid %t with faults %v", res.Valid, res.Faults)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package checker
+
+import (
+	"slices"
+	"time"
+)
+
+type LatencyStats struct {
+	Count  int
+	Median time.Duration
+	P95    time.Duration
+	Max    time.Duration
+}
+
+// Latencies computes the statistics of the given samples.
+func Latencies(samples []time.Duration) LatencyStats {
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+
+	sorted := slices.Clone(samples)
+	slices.Sort(sorted)
+
+	return LatencyStats{
+		Count:  len(sorted),
+		Median: quantile(sorted, 0.5),
+		P95:    quantile(sorted, 0.95),
+		Max:    sorted[len(sorted)-1]}
+}
+
+// quantile uses the nearest-rank method on sorted samples.
+func quantile(sorted []time.Duration, q float64) time.Duration {
+	rank := int(q*float64(len(sorted))+0.5) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
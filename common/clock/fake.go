@@ -0,0 +1,221 @@
+package clock
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a clock that only moves when told to. Tickers, timers and
+// deadlines fire as Advance or Set moves the time past them.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*waiter
+}
+
+type waiter struct {
+	at time.Time
+	// 0 for one-shot waiters
+	period time.Duration
+	fire   func(now time.Time)
+}
+
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the clock forward by d, firing everything due on the way
+// in order.
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to t. Moving it backwards, e.g. to simulate an NTP
+// step, fires nothing; waiters stay due at their original time.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	for {
+		sort.Slice(f.waiters, func(i, j int) bool {
+			return f.waiters[i].at.Before(f.waiters[j].at)
+		})
+		if len(f.waiters) == 0 || f.waiters[0].at.After(t) {
+			break
+		}
+
+		w := f.waiters[0]
+		due := w.at
+		f.now = due
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			f.waiters = f.waiters[1:]
+		}
+
+		// waiters may call back into the clock
+		f.mu.Unlock()
+		w.fire(due)
+		f.mu.Lock()
+	}
+	f.now = t
+	f.mu.Unlock()
+}
+
+// Next returns the time the earliest ticker, timer or deadline is due at,
+// false if nothing is waiting for the clock.
+func (f *Fake) Next() (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.waiters) == 0 {
+		return time.Time{}, false
+	}
+	next := f.waiters[0].at
+	for _, w := range f.waiters[1:] {
+		if w.at.Before(next) {
+			next = w.at
+		}
+	}
+	return next, true
+}
+
+func (f *Fake) add(w *waiter) {
+	f.mu.Lock()
+	f.waiters = append(f.waiters, w)
+	f.mu.Unlock()
+}
+
+func (f *Fake) remove(w *waiter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, other := range f.waiters {
+		if other == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	c := make(chan time.Time, 1)
+	w := &waiter{
+		at:     f.Now().Add(d),
+		period: d,
+		fire: func(now time.Time) {
+			// like time.Ticker, drop ticks for slow receivers
+			select {
+			case c <- now:
+			default:
+			}
+		}}
+	f.add(w)
+	return &fakeTicker{f: f, w: w, c: c}
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	c := make(chan time.Time, 1)
+	f.add(&waiter{
+		at: f.Now().Add(d),
+		fire: func(now time.Time) {
+			c <- now
+		}})
+	return c
+}
+
+func (f *Fake) WithDeadline(parent context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
+	ctx := &deadlineCtx{
+		parent:   parent,
+		deadline: deadline,
+		done:     make(chan struct{})}
+	stop := context.AfterFunc(parent, func() {
+		ctx.cancel(parent.Err())
+	})
+
+	w := &waiter{
+		at: deadline,
+		fire: func(time.Time) {
+			ctx.cancel(context.DeadlineExceeded)
+		}}
+	if !deadline.After(f.Now()) {
+		w.fire(deadline)
+	} else {
+		f.add(w)
+	}
+
+	return ctx, func() {
+		f.remove(w)
+		stop()
+		ctx.cancel(context.Canceled)
+	}
+}
+
+func (f *Fake) WithTimeout(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return f.WithDeadline(parent, f.Now().Add(timeout))
+}
+
+type fakeTicker struct {
+	f *Fake
+	w *waiter
+	c chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.f.remove(t.w)
+}
+
+// deadlineCtx reports context.DeadlineExceeded once the fake clock passes
+// its deadline, same as the context of context.WithDeadline. It doesn't
+// embed a context of package context, which would hand its own error,
+// context.Canceled, to the contexts derived from it.
+type deadlineCtx struct {
+	parent   context.Context
+	deadline time.Time
+	done     chan struct{}
+	mu       sync.Mutex
+	err      error
+}
+
+func (c *deadlineCtx) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *deadlineCtx) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *deadlineCtx) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+func (c *deadlineCtx) Value(key any) any {
+	return c.parent.Value(key)
+}
+
+func (c *deadlineCtx) cancel(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err == nil {
+		c.err = err
+		close(c.done)
+	}
+}
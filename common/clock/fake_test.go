@@ -0,0 +1,224 @@
+package clock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeAfter(t *testing.T) {
+	f := NewFake(start)
+	c := f.After(time.Second)
+
+	f.Advance(999 * time.Millisecond)
+	select {
+	case <-c:
+		t.Fatal("fired before its time")
+	default:
+	}
+
+	f.Advance(time.Millisecond)
+	select {
+	case now := <-c:
+		if !now.Equal(start.Add(time.Second)) {
+			t.Errorf("fired at %s, want %s", now, start.Add(time.Second))
+		}
+	default:
+		t.Fatal("didn't fire at its time")
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(start)
+	ticker := f.NewTicker(100 * time.Millisecond)
+
+	for i := 1; i <= 3; i++ {
+		f.Advance(100 * time.Millisecond)
+		select {
+		case now := <-ticker.C():
+			if want := start.Add(time.Duration(i) * 100 * time.Millisecond); !now.Equal(want) {
+				t.Errorf("tick %d at %s, want %s", i, now, want)
+			}
+		default:
+			t.Fatalf("no tick %d", i)
+		}
+	}
+
+	// like time.Ticker, a slow receiver only gets the first of the ticks
+	f.Advance(time.Second)
+	if now := <-ticker.C(); !now.Equal(start.Add(400 * time.Millisecond)) {
+		t.Errorf("tick at %s, want the first one missed", now)
+	}
+	select {
+	case <-ticker.C():
+		t.Error("got more than one missed tick")
+	default:
+	}
+
+	ticker.Stop()
+	f.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Error("ticked after Stop")
+	default:
+	}
+}
+
+func TestFakeOrder(t *testing.T) {
+	f := NewFake(start)
+	late := f.After(2 * time.Second)
+	early := f.After(time.Second)
+
+	// waiters fire in the order they're due, with the clock at their time
+	var order []time.Duration
+	f.add(&waiter{
+		at: start.Add(1500 * time.Millisecond),
+		fire: func(now time.Time) {
+			order = append(order, f.Now().Sub(start))
+		}})
+	f.Advance(3 * time.Second)
+	if len(order) != 1 || order[0] != 1500*time.Millisecond {
+		t.Errorf("clock at %v while firing, want [1.5s]", order)
+	}
+	if e, l := <-early, <-late; !e.Before(l) {
+		t.Errorf("early fired at %s, late at %s", e, l)
+	}
+	if !f.Now().Equal(start.Add(3 * time.Second)) {
+		t.Errorf("Now = %s after Advance, want %s", f.Now(), start.Add(3*time.Second))
+	}
+}
+
+func TestFakeSetBackwards(t *testing.T) {
+	f := NewFake(start)
+	c := f.After(time.Second)
+
+	f.Set(start.Add(-time.Hour))
+	f.Advance(time.Hour)
+	select {
+	case <-c:
+		t.Fatal("fired after the clock was set back")
+	default:
+	}
+
+	f.Advance(time.Second)
+	select {
+	case <-c:
+	default:
+		t.Fatal("didn't fire at its original time")
+	}
+}
+
+func TestFakeNext(t *testing.T) {
+	f := NewFake(start)
+	if _, ok := f.Next(); ok {
+		t.Fatal("something due on a new clock")
+	}
+
+	ticker := f.NewTicker(300 * time.Millisecond)
+	f.After(time.Second)
+	_, cancel := f.WithTimeout(context.Background(), 200*time.Millisecond)
+	if next, _ := f.Next(); !next.Equal(start.Add(200 * time.Millisecond)) {
+		t.Errorf("next at %s, want the deadline", next)
+	}
+
+	cancel()
+	if next, _ := f.Next(); !next.Equal(start.Add(300 * time.Millisecond)) {
+		t.Errorf("next at %s, want the tick", next)
+	}
+
+	f.Advance(300 * time.Millisecond)
+	if next, _ := f.Next(); !next.Equal(start.Add(600 * time.Millisecond)) {
+		t.Errorf("next at %s, want the following tick", next)
+	}
+
+	ticker.Stop()
+	f.Advance(time.Second)
+	if next, ok := f.Next(); ok {
+		t.Errorf("next at %s after everything fired", next)
+	}
+}
+
+func TestFakeDeadline(t *testing.T) {
+	f := NewFake(start)
+	ctx, cancel := f.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	child, cancelChild := context.WithCancel(ctx)
+	defer cancelChild()
+
+	if deadline, ok := ctx.Deadline(); !ok || !deadline.Equal(start.Add(time.Second)) {
+		t.Errorf("Deadline = %s, %t, want %s", deadline, ok, start.Add(time.Second))
+	}
+	f.Advance(999 * time.Millisecond)
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("Err = %v before the deadline", err)
+	}
+
+	f.Advance(time.Millisecond)
+	<-ctx.Done()
+	if err := ctx.Err(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Err = %v, want context.DeadlineExceeded", err)
+	}
+	if err := context.Cause(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Cause = %v, want context.DeadlineExceeded", err)
+	}
+	<-child.Done()
+	if err := child.Err(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Err of a derived context = %v, want context.DeadlineExceeded", err)
+	}
+
+	// cancelling afterwards doesn't change the error
+	cancel()
+	if err := ctx.Err(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Err = %v after cancel, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestFakeDeadlinePassed(t *testing.T) {
+	f := NewFake(start)
+	ctx, cancel := f.WithDeadline(context.Background(), start)
+	defer cancel()
+
+	select {
+	case <-ctx.Done():
+	default:
+		t.Fatal("not done with the deadline already passed")
+	}
+	if err := ctx.Err(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestFakeDeadlineCancel(t *testing.T) {
+	f := NewFake(start)
+	ctx, cancel := f.WithTimeout(context.Background(), time.Second)
+	cancel()
+
+	<-ctx.Done()
+	if err := ctx.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Err = %v, want context.Canceled", err)
+	}
+	// the deadline no longer fires
+	f.Advance(time.Second)
+	if err := ctx.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Err = %v after the deadline, want context.Canceled", err)
+	}
+	if len(f.waiters) != 0 {
+		t.Errorf("%d waiters left after cancel", len(f.waiters))
+	}
+}
+
+func TestFakeDeadlineParent(t *testing.T) {
+	f := NewFake(start)
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := f.WithTimeout(parent, time.Second)
+	defer cancel()
+
+	cancelParent()
+	<-ctx.Done()
+	if err := ctx.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Err = %v, want the parent's context.Canceled", err)
+	}
+}
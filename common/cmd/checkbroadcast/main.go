@@ -0,0 +1,90 @@
+// Command checkbroadcast checks a recorded broadcast history (a JSON
+// checker.BroadcastHistory) and exits with a non-zero status if any value
+// was lost or the run drifted past the targets of a challenge.
+//
+// With -recorded it reads the histories written by the nodes themselves
+// (see package history) instead, e.g. checkbroadcast -recorded dir/*.jsonl.
+// Those don't include the messages between nodes, so msgs-per-op is
+// unknown and the #3d and #3e targets fail.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"common/checker"
+	"common/history"
+)
+
+// noTargets can't be exceeded
+var noTargets = checker.Targets{MsgsPerOp: 1e9, Median: 1 << 62, Max: 1 << 62}
+
+func main() {
+	targetsName := flag.String("targets", "", "targets to enforce: 3d, 3e or none")
+	recorded := flag.Bool("recorded", false, "read the histories recorded by the nodes instead, one file per node")
+	flag.Parse()
+
+	var h checker.BroadcastHistory
+	if *recorded {
+		ops, err := history.LoadFiles(flag.Args())
+		if err != nil {
+			log.Fatal(err)
+		}
+		h = history.Broadcast(ops)
+	} else {
+		var in io.Reader = os.Stdin
+		if flag.NArg() > 0 {
+			f, err := os.Open(flag.Arg(0))
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			in = f
+		}
+
+		if err := json.NewDecoder(in).Decode(&h); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	res := checker.CheckBroadcast(h)
+	if *recorded {
+		fmt.Printf("ops: %d, server messages: unknown, msgs-per-op: unknown\n", res.Ops)
+	} else {
+		fmt.Printf("ops: %d, server messages: %d, msgs-per-op: %.2f\n",
+			res.Ops, res.ServerMessages, res.MsgsPerOp)
+	}
+	fmt.Printf("stable latency: median %s, p95 %s, max %s (%d values, %d never stable)\n",
+		res.StableLatency.Median, res.StableLatency.P95, res.StableLatency.Max,
+		res.StableLatency.Count, res.NeverStable)
+
+	targets := noTargets
+	switch *targetsName {
+	case "3d":
+		targets = checker.Targets3D
+	case "3e":
+		targets = checker.Targets3E
+	case "", "none":
+	default:
+		log.Fatalf("unknown targets %q", *targetsName)
+	}
+
+	err := res.Check(targets)
+	if *recorded && targets != noTargets {
+		unknown := errors.New("msgs-per-op unknown, the recorded histories don't include the messages between nodes")
+		if err != nil {
+			unknown = fmt.Errorf("%w; %w", err, unknown)
+		}
+		err = unknown
+	}
+	if err != nil {
+		fmt.Println("FAIL:", err)
+		os.Exit(1)
+	}
+	fmt.Println("OK")
+}
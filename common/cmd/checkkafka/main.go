@@ -0,0 +1,63 @@
+// Command checkkafka checks a recorded kafka history (a JSON
+// checker.KafkaHistory) and exits with a non-zero status if any fault
+// was found.
+//
+// With -recorded it reads the histories written by the nodes themselves
+// (see package history) instead, e.g. checkkafka -recorded dir/*.jsonl.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"slices"
+
+	"common/checker"
+	"common/history"
+)
+
+func main() {
+	recorded := flag.Bool("recorded", false, "read the histories recorded by the nodes instead, one file per node")
+	flag.Parse()
+
+	var h checker.KafkaHistory
+	if *recorded {
+		ops, err := history.LoadFiles(flag.Args())
+		if err != nil {
+			log.Fatal(err)
+		}
+		h = history.Kafka(ops)
+	} else {
+		var in io.Reader = os.Stdin
+		if flag.NArg() > 0 {
+			f, err := os.Open(flag.Arg(0))
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			in = f
+		}
+
+		if err := json.NewDecoder(in).Decode(&h); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	res := checker.CheckKafka(h)
+	for _, fault := range res.Faults {
+		fmt.Println(fault)
+	}
+	for _, kind := range slices.Sorted(maps.Keys(res.Counts)) {
+		fmt.Printf("%s: %d\n", kind, res.Counts[kind])
+	}
+
+	if !res.Valid {
+		fmt.Println("FAIL")
+		os.Exit(1)
+	}
+	fmt.Println("OK")
+}
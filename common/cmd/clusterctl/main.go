@@ -0,0 +1,52 @@
+// Command clusterctl sends a single request to a standalone cluster (see
+// package transport) and prints the reply, e.g.
+//
+//	clusterctl -addr tcp:127.0.0.1:7000 -dest n1 '{"type":"broadcast","message":3}'
+//
+// It exits with a non-zero status on an error reply or a timeout.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"common/transport"
+)
+
+func main() {
+	addr := flag.String("addr", "tcp:127.0.0.1:7000", "address of the node to connect to")
+	dest := flag.String("dest", "n0", "destination of the request")
+	id := flag.String("id", "c1", "client ID")
+	timeout := flag.Duration("timeout", 5*time.Second, "time to wait for the reply")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: clusterctl [flags] body")
+		os.Exit(2)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal([]byte(flag.Arg(0)), &body); err != nil {
+		log.Fatal(err)
+	}
+
+	c, err := transport.Dial(*addr, *id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	res, err := c.Call(ctx, *dest, body)
+	if res.Body != nil {
+		fmt.Println(string(res.Body))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
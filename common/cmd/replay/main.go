@@ -0,0 +1,308 @@
+// Command replay feeds a transcript captured from a node (see package
+// capture) into a fresh process of a challenge binary and compares what it
+// sends with what the original node sent, e.g.
+//
+//	go build -o /tmp/3e ../3E-Broadcast
+//	go run ./cmd/replay -bin /tmp/3e capture/n1.jsonl
+//
+// Messages are fed at their original pace (see -speed). A reply to a
+// request of the node is held back until the fresh node has sent the same
+// request, and its in_reply_to is rewritten to the new msg_id. Outbound
+// messages are compared as a multiset of destination and body, without
+// msg_id and trace IDs, since concurrent handlers don't send in a fixed
+// order, and arrays under the keys given by -unordered are sorted, since
+// the broadcast nodes keep their values in maps. It exits with a non-zero
+// status if the messages differ, which makes it usable with git bisect run.
+//
+// Arguments after the transcript are passed on to the binary.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"common/capture"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// Keys that differ between runs without the behavior differing.
+var volatileKeys = []string{"msg_id", "trace_id", "span_id"}
+
+type replayer struct {
+	ignore    map[string]bool
+	unordered []string
+	mu        sync.Mutex
+	// closed and replaced whenever the node sends something
+	changed chan struct{}
+	// key -> number of original messages not matched by the replay yet
+	remaining map[string]int
+	// key -> msg_ids of those messages, in the original order
+	origIDs map[string][]int
+	// original msg_id of a request -> msg_id of the same request in the replay
+	ids   map[int]int
+	extra []string
+}
+
+func main() {
+	bin := flag.String("bin", "", "challenge binary to replay the transcript against")
+	speed := flag.Float64("speed", 1, "pace of the replay relative to the original, 0 for no waiting")
+	wait := flag.Duration("wait", 2*time.Second, "how long a reply is held back for the request it answers")
+	settle := flag.Duration("settle", time.Second, "time the node gets to react to the last message")
+	ignore := flag.String("ignore", "", "comma-separated message types to leave out of the comparison")
+	show := flag.Int("show", 20, "number of differing messages to print")
+	unordered := flag.String("unordered", "messages", "comma-separated body keys whose arrays are compared as sets")
+	flag.Parse()
+	if *bin == "" || flag.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "usage: replay -bin binary [flags] transcript [args]")
+		os.Exit(2)
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	entries, err := capture.Load(f)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := &replayer{
+		ignore:    make(map[string]bool),
+		changed:   make(chan struct{}),
+		remaining: make(map[string]int),
+		origIDs:   make(map[string][]int),
+		ids:       make(map[int]int)}
+	for _, typ := range strings.Split(*ignore, ",") {
+		if typ != "" {
+			r.ignore[typ] = true
+		}
+	}
+	for _, key := range strings.Split(*unordered, ",") {
+		if key != "" {
+			r.unordered = append(r.unordered, key)
+		}
+	}
+
+	var sent int
+	for _, e := range entries {
+		if e.Dir != capture.Out || r.ignore[e.Msg.Type()] {
+			continue
+		}
+		key, id := r.normalize(e.Msg)
+		r.remaining[key]++
+		r.origIDs[key] = append(r.origIDs[key], id)
+		sent++
+	}
+
+	cmd := exec.Command(*bin, flag.Args()[1:]...)
+	cmd.Env = childEnv()
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		log.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		log.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		r.read(stdout)
+		close(done)
+	}()
+
+	var stdinMx sync.Mutex
+	feed := func(msg maelstrom.Message) {
+		buf, err := json.Marshal(msg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stdinMx.Lock()
+		defer stdinMx.Unlock()
+		if _, err := stdin.Write(append(buf, '\n')); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// replies wait for their requests on the side, so that they don't hold
+	// up the messages behind them
+	var replies sync.WaitGroup
+	start := time.Now()
+	for _, e := range entries {
+		if e.Dir != capture.In {
+			continue
+		}
+		if *speed > 0 {
+			time.Sleep(time.Until(start.Add(time.Duration(float64(e.At) / *speed))))
+		}
+
+		if inReplyTo(e.Msg) == 0 {
+			feed(e.Msg)
+			continue
+		}
+		replies.Add(1)
+		go func() {
+			defer replies.Done()
+			msg, err := r.rewrite(e.Msg, *wait)
+			if err != nil {
+				log.Print(err)
+			}
+			feed(msg)
+		}()
+	}
+
+	replies.Wait()
+	time.Sleep(*settle)
+	stdin.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		log.Print("node didn't exit, killing it")
+		cmd.Process.Kill()
+	}
+	cmd.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var missing []string
+	for key, count := range r.remaining {
+		for range count {
+			missing = append(missing, key)
+		}
+	}
+	slices.Sort(missing)
+	slices.Sort(r.extra)
+
+	fmt.Printf("original: %d sent, replay: %d missing, %d extra\n", sent, len(missing), len(r.extra))
+	for _, key := range missing[:min(len(missing), *show)] {
+		fmt.Println("- " + key)
+	}
+	for _, key := range r.extra[:min(len(r.extra), *show)] {
+		fmt.Println("+ " + key)
+	}
+	if len(missing) > 0 || len(r.extra) > 0 {
+		os.Exit(1)
+	}
+	fmt.Println("OK")
+}
+
+// childEnv keeps the replayed node from overwriting the transcript or
+// joining a standalone cluster.
+func childEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "GLOMERS_CAPTURE_DIR=") && !strings.HasPrefix(kv, "GLOMERS_TRANSPORT_") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// read matches everything the node sends against the original messages.
+func (r *replayer) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var msg maelstrom.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("replay: %s", err)
+			continue
+		}
+		if r.ignore[msg.Type()] {
+			continue
+		}
+		key, id := r.normalize(msg)
+
+		r.mu.Lock()
+		if r.remaining[key] > 0 {
+			r.remaining[key]--
+			orig := r.origIDs[key][0]
+			r.origIDs[key] = r.origIDs[key][1:]
+			if orig != 0 && id != 0 {
+				r.ids[orig] = id
+			}
+		} else {
+			r.extra = append(r.extra, key)
+		}
+		close(r.changed)
+		r.changed = make(chan struct{})
+		r.mu.Unlock()
+	}
+}
+
+// rewrite points a reply to a request of the node at the msg_id the fresh
+// node used for the same request, waiting up to wait for it to be sent.
+func (r *replayer) rewrite(msg maelstrom.Message, wait time.Duration) (maelstrom.Message, error) {
+	var body map[string]any
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return msg, err
+	}
+	inReplyTo, _ := body["in_reply_to"].(float64)
+
+	timeout := time.After(wait)
+	for {
+		r.mu.Lock()
+		id, ok := r.ids[int(inReplyTo)]
+		changed := r.changed
+		r.mu.Unlock()
+		if ok {
+			body["in_reply_to"] = id
+			buf, err := json.Marshal(body)
+			if err != nil {
+				return msg, err
+			}
+			msg.Body = buf
+			return msg, nil
+		}
+
+		select {
+		case <-changed:
+		case <-timeout:
+			return msg, fmt.Errorf("node didn't send the request %s is answering (msg_id %d), feeding it as is", msg.Src, int(inReplyTo))
+		}
+	}
+}
+
+func inReplyTo(msg maelstrom.Message) int {
+	var body maelstrom.MessageBody
+	json.Unmarshal(msg.Body, &body)
+	return body.InReplyTo
+}
+
+// normalize returns the destination and body of msg without the keys that
+// vary between runs, along with its msg_id.
+func (r *replayer) normalize(msg maelstrom.Message) (string, int) {
+	var body map[string]any
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return msg.Dest + " " + string(msg.Body), 0
+	}
+	id, _ := body["msg_id"].(float64)
+	for _, key := range volatileKeys {
+		delete(body, key)
+	}
+	for _, key := range r.unordered {
+		if values, ok := body[key].([]any); ok {
+			slices.SortFunc(values, func(a, b any) int {
+				return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+			})
+		}
+	}
+	buf, _ := json.Marshal(body)
+	return msg.Dest + " " + string(buf), int(id)
+}
@@ -0,0 +1,202 @@
+// Command router runs a challenge locally without Maelstrom. It starts
+// -node-count copies of a challenge binary, routes messages between their
+// stdin and stdout over a simulated network (see package sim) together with
+// local seq-kv, lin-kv and lww-kv services, sends init, drives a client
+// workload and checks the results, e.g.
+//
+//	go build -o /tmp/3d ../3D-Broadcast
+//	go run ./cmd/router -bin /tmp/3d -workload broadcast -node-count 25 -latency 100ms -targets 3d
+//
+// Arguments after the flags are passed on to every node. It exits with a
+// non-zero status if the workload fails its check.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"common/kvstore"
+	"common/sim"
+)
+
+var workloads = map[string]func(r *router) error{
+	"echo":       runEcho,
+	"unique-ids": runUniqueIDs,
+	"broadcast":  runBroadcast,
+	"g-counter":  runGCounter,
+	"kafka":      runKafka}
+
+type router struct {
+	nw          *sim.Network
+	nodes       []string
+	seed        uint64
+	rate        float64
+	concurrency int
+	timeLimit   time.Duration
+	timeout     time.Duration
+	finalWait   time.Duration
+	targets     string
+	keyCount    int
+	history     string
+}
+
+func main() {
+	bin := flag.String("bin", "", "challenge binary to run")
+	workload := flag.String("workload", "", "echo, unique-ids, broadcast, g-counter or kafka")
+	nodeCount := flag.Int("node-count", 5, "number of nodes")
+	latency := flag.Duration("latency", 0, "base latency of every message between two endpoints")
+	jitter := flag.Duration("jitter", 0, "random latency added on top of -latency")
+	loss := flag.Float64("loss", 0, "probability of a message between two nodes getting lost")
+	seqStaleness := flag.Float64("seq-staleness", 0, "probability of a stale seq-kv read")
+	lwwStaleness := flag.Float64("lww-staleness", 0, "probability of an lww-kv read returning an older value")
+	seed := flag.Uint64("seed", 1, "seed of the network and the workload")
+	isolate := flag.String("isolate", "", "node to cut off from the other nodes during the workload")
+	isolateAt := flag.Duration("isolate-at", 0, "time after init the node is cut off at")
+	healAt := flag.Duration("heal-at", 0, "time after init the partition heals at, 0 for never")
+	logDir := flag.String("log-dir", "", "directory for the logs of the nodes and the router, discarded if empty")
+
+	r := router{}
+	flag.Float64Var(&r.rate, "rate", 10, "requests per second over all clients")
+	flag.IntVar(&r.concurrency, "concurrency", 4, "number of clients")
+	flag.DurationVar(&r.timeLimit, "time-limit", 10*time.Second, "how long the workload runs")
+	flag.DurationVar(&r.timeout, "timeout", time.Second, "time a client waits for a reply")
+	flag.DurationVar(&r.finalWait, "final-wait", 2*time.Second, "time to wait before the final reads")
+	flag.StringVar(&r.targets, "targets", "", "broadcast targets to enforce: 3d, 3e or none")
+	flag.IntVar(&r.keyCount, "key-count", 4, "number of kafka keys")
+	flag.StringVar(&r.history, "history", "", "file to write the broadcast or kafka history to")
+	flag.Parse()
+
+	run, ok := workloads[*workload]
+	if !ok {
+		log.Fatalf("unknown workload %q", *workload)
+	}
+	if *bin == "" {
+		log.Fatal("missing -bin")
+	}
+	r.seed = *seed
+
+	// like the nodes, the clients and services log every message they send
+	// and receive
+	logOut := io.Discard
+	if *logDir != "" {
+		f, err := os.Create(filepath.Join(*logDir, "router.log"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		logOut = f
+	}
+
+	r.nw = sim.New(sim.Config{
+		Seed:    *seed,
+		Latency: sim.Latency{Base: *latency, Jitter: *jitter},
+		Loss:    *loss})
+	kvstore.NewLinKV().Attach(r.nw)
+	kvstore.NewSeqKV(*seqStaleness, *seed).Attach(r.nw)
+	kvstore.NewLWWKV(*lwwStaleness, *seed).Attach(r.nw)
+
+	var cmds []*exec.Cmd
+	for i := range *nodeCount {
+		id := fmt.Sprintf("n%d", i)
+		cmd, err := r.spawn(id, *bin, flag.Args(), *logDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+		r.nodes = append(r.nodes, id)
+	}
+
+	log.SetOutput(logOut)
+	ctx, cancel := context.WithCancel(context.Background())
+	go r.nw.Run(ctx)
+
+	initCtx, initCancel := context.WithTimeout(ctx, 10*time.Second)
+	err := r.nw.StartRunning(initCtx)
+	initCancel()
+	if err == nil && *isolate != "" {
+		// the workload runs in real time, so does the partition
+		partition := time.AfterFunc(*isolateAt, func() {
+			log.Printf("router: isolating %s", *isolate)
+			r.nw.Isolate(*isolate)
+		})
+		defer partition.Stop()
+		if *healAt > 0 {
+			heal := time.AfterFunc(*healAt, func() {
+				log.Print("router: healing")
+				r.nw.Heal()
+			})
+			defer heal.Stop()
+		}
+	}
+	if err == nil {
+		err = run(&r)
+	}
+
+	cancel()
+	r.nw.Close()
+	for i, cmd := range cmds {
+		wait(r.nodes[i], cmd)
+	}
+
+	if err != nil {
+		fmt.Println("FAIL:", err)
+		os.Exit(1)
+	}
+	fmt.Println("OK")
+}
+
+func (r *router) spawn(id, bin string, args []string, logDir string) (*exec.Cmd, error) {
+	cmd := exec.Command(bin, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if logDir != "" {
+		f, err := os.Create(filepath.Join(logDir, id+".log"))
+		if err != nil {
+			return nil, err
+		}
+		cmd.Stderr = f
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", id, err)
+	}
+	r.nw.AttachNode(id, stdin, stdout)
+	return cmd, nil
+}
+
+// wait gives a node a few seconds to exit after its stdin was closed
+// before killing it.
+func wait(id string, cmd *exec.Cmd) {
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s exited: %s\n", id, err)
+		}
+	case <-time.After(5 * time.Second):
+		fmt.Fprintf(os.Stderr, "%s didn't exit, killing it\n", id)
+		cmd.Process.Kill()
+		<-done
+	}
+	if f, ok := cmd.Stderr.(io.Closer); ok {
+		f.Close()
+	}
+}
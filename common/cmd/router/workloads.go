@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"common/api"
+	"common/checker"
+	"common/sim"
+	"common/workload"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// request sends body to dest and waits up to the client timeout.
+func (r *router) request(c *sim.Client, dest string, body any) (maelstrom.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	return c.Request(ctx, dest, body)
+}
+
+// generate runs op from every client at the configured rate until the time
+// limit passes. i is the number of the client.
+func (r *router) generate(op func(i int, c *sim.Client, rng *rand.Rand)) {
+	interval := time.Duration(float64(r.concurrency) / r.rate * float64(time.Second))
+	deadline := time.Now().Add(r.timeLimit)
+
+	var wg sync.WaitGroup
+	for i := range r.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := r.nw.Client()
+			rng := rand.New(rand.NewPCG(r.seed, uint64(i)))
+			for time.Now().Before(deadline) {
+				start := time.Now()
+				op(i, c, rng)
+				time.Sleep(interval - time.Since(start))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (r *router) pick(rng *rand.Rand) string {
+	return r.nodes[rng.IntN(len(r.nodes))]
+}
+
+// indefinite tells whether a failed request may still have taken effect.
+func indefinite(err error) bool {
+	var rpcErr *maelstrom.RPCError
+	return !errors.As(err, &rpcErr) || rpcErr.Code == maelstrom.Timeout || rpcErr.Code == maelstrom.Crash
+}
+
+func (r *router) writeHistory(h any) error {
+	if r.history == "" {
+		return nil
+	}
+	buf, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.history, buf, 0o644)
+}
+
+func runEcho(r *router) error {
+	var mu sync.Mutex
+	var ok, failed, mismatched int
+
+	r.generate(func(i int, c *sim.Client, rng *rand.Rand) {
+		payload := fmt.Sprintf("Please echo %d", rng.IntN(128))
+		reqBody := api.Echo{
+			MessageBody: maelstrom.MessageBody{Type: "echo"},
+			Echo:        payload}
+		res, err := r.request(c, r.pick(rng), reqBody)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failed++
+			return
+		}
+		resBody, err := api.Decode[api.EchoOK](res)
+		if err != nil || resBody.Echo != payload {
+			mismatched++
+			return
+		}
+		ok++
+	})
+
+	fmt.Printf("echo: %d ok, %d failed, %d mismatched\n", ok, failed, mismatched)
+	if mismatched > 0 || ok == 0 {
+		return errors.New("echo replies didn't match the requests")
+	}
+	return nil
+}
+
+func runUniqueIDs(r *router) error {
+	var mu sync.Mutex
+	// ID as JSON -> node that generated it
+	seen := make(map[string]string)
+	var failed, duplicates int
+
+	r.generate(func(i int, c *sim.Client, rng *rand.Rand) {
+		node := r.pick(rng)
+		reqBody := maelstrom.MessageBody{
+			Type: "generate"}
+		res, err := r.request(c, node, reqBody)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failed++
+			return
+		}
+		var resBody struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := json.Unmarshal(res.Body, &resBody); err != nil || resBody.ID == nil {
+			failed++
+			return
+		}
+		id := string(resBody.ID)
+		if prev, ok := seen[id]; ok {
+			fmt.Printf("duplicate id %s from %s and %s\n", id, prev, node)
+			duplicates++
+			return
+		}
+		seen[id] = node
+	})
+
+	fmt.Printf("unique-ids: %d ids, %d failed, %d duplicates\n", len(seen), failed, duplicates)
+	if duplicates > 0 || len(seen) == 0 {
+		return errors.New("ids aren't unique")
+	}
+	return nil
+}
+
+func runBroadcast(r *router) error {
+	targets := checker.Targets{MsgsPerOp: math.Inf(1), Median: math.MaxInt64, Max: math.MaxInt64}
+	switch r.targets {
+	case "3d":
+		targets = checker.Targets3D
+	case "3e":
+		targets = checker.Targets3E
+	case "", "none":
+	default:
+		return fmt.Errorf("unknown targets %q", r.targets)
+	}
+
+	c := r.nw.Client()
+	topology := workload.Grid(r.nodes)
+	for _, node := range r.nodes {
+		reqBody := api.Topology{
+			MessageBody: maelstrom.MessageBody{Type: "topology"},
+			Topology:    topology}
+		if _, err := r.request(c, node, reqBody); err != nil {
+			return fmt.Errorf("topology %s: %w", node, err)
+		}
+	}
+
+	var mu sync.Mutex
+	h := checker.BroadcastHistory{
+		Nodes: r.nodes}
+	r.nw.Observe(func(d sim.Delivery) {
+		mu.Lock()
+		h.Messages = append(h.Messages, checker.Message{Src: d.Msg.Src, Dest: d.Msg.Dest, At: d.At})
+		mu.Unlock()
+	})
+
+	read := func(c *sim.Client, node string) {
+		op := checker.BroadcastOp{
+			Node:   node,
+			F:      "read",
+			Invoke: r.nw.Now()}
+		reqBody := api.Read{
+			MessageBody: maelstrom.MessageBody{Type: "read"}}
+		res, err := r.request(c, node, reqBody)
+		op.Complete = r.nw.Now()
+		if err == nil {
+			resBody, err := api.Decode[api.ReadOK](res)
+			op.Read = resBody.Messages
+			op.OK = err == nil
+		}
+
+		mu.Lock()
+		h.Ops = append(h.Ops, op)
+		mu.Unlock()
+	}
+
+	var next float64
+	r.generate(func(i int, c *sim.Client, rng *rand.Rand) {
+		node := r.pick(rng)
+		if rng.IntN(2) == 0 {
+			read(c, node)
+			return
+		}
+
+		mu.Lock()
+		value := next
+		next++
+		mu.Unlock()
+
+		op := checker.BroadcastOp{
+			Node:   node,
+			F:      "broadcast",
+			Value:  value,
+			Invoke: r.nw.Now()}
+		reqBody := api.Broadcast{
+			MessageBody: maelstrom.MessageBody{Type: "broadcast"},
+			Message:     &value}
+		_, err := r.request(c, node, reqBody)
+		op.Complete = r.nw.Now()
+		op.OK = err == nil
+
+		mu.Lock()
+		h.Ops = append(h.Ops, op)
+		mu.Unlock()
+	})
+
+	// keep reading while waiting, so that the latency of the values
+	// broadcast last is measured by reads rather than by the wait
+	waitEnd := time.Now().Add(r.finalWait)
+	for i := 0; time.Now().Before(waitEnd); i++ {
+		read(c, r.nodes[i%len(r.nodes)])
+		time.Sleep(time.Duration(float64(time.Second) / r.rate))
+	}
+	for _, node := range r.nodes {
+		read(c, node)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := r.writeHistory(h); err != nil {
+		return err
+	}
+
+	res := checker.CheckBroadcast(h)
+	fmt.Printf("broadcast: %d ops, %d server messages, %.2f msgs-per-op\n", res.Ops, res.ServerMessages, res.MsgsPerOp)
+	fmt.Printf("stable latency: median %s, p95 %s, max %s (%d values, %d never stable)\n",
+		res.StableLatency.Median, res.StableLatency.P95, res.StableLatency.Max,
+		res.StableLatency.Count, res.NeverStable)
+	return res.Check(targets)
+}
+
+func runGCounter(r *router) error {
+	var mu sync.Mutex
+	// sums of the acknowledged deltas and of those that may or may not
+	// have been applied
+	var acked, unknown int
+
+	r.generate(func(i int, c *sim.Client, rng *rand.Rand) {
+		delta := rng.IntN(5)
+		reqBody := api.Add{
+			MessageBody: maelstrom.MessageBody{Type: "add"},
+			Delta:       &delta}
+		_, err := r.request(c, r.pick(rng), reqBody)
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err == nil {
+			acked += delta
+		} else if indefinite(err) {
+			unknown += delta
+		}
+	})
+
+	time.Sleep(r.finalWait)
+	c := r.nw.Client()
+	var problems []error
+	for _, node := range r.nodes {
+		reqBody := api.Read{
+			MessageBody: maelstrom.MessageBody{Type: "read"}}
+		res, err := r.request(c, node, reqBody)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("final read %s: %w", node, err))
+			continue
+		}
+		resBody, err := api.Decode[api.ReadValueOK](res)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("final read %s: %w", node, err))
+			continue
+		}
+		fmt.Printf("%s read %d\n", node, resBody.Value)
+		if resBody.Value < acked || resBody.Value > acked+unknown {
+			problems = append(problems, fmt.Errorf("%s read %d, expected between %d and %d", node, resBody.Value, acked, acked+unknown))
+		}
+	}
+
+	fmt.Printf("g-counter: %d acknowledged, %d unknown\n", acked, unknown)
+	return errors.Join(problems...)
+}
+
+func runKafka(r *router) error {
+	keys := make([]string, r.keyCount)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	var mu sync.Mutex
+	var h checker.KafkaHistory
+	var next float64
+	// key -> highest offset polled by any client, committed by client 0 only
+	// so that commits are sequential
+	polled := make(map[string]int)
+
+	r.generate(func(i int, c *sim.Client, rng *rand.Rand) {
+		node := r.pick(rng)
+		op := checker.KafkaOp{
+			Node: node}
+
+		// sends half of the time, otherwise mostly polls
+		f := "poll"
+		switch roll := rng.IntN(10); {
+		case roll < 5:
+			f = "send"
+		case roll == 8 && i == 0:
+			f = "commit_offsets"
+		case roll == 9:
+			f = "list_committed_offsets"
+		}
+
+		var reqBody any
+		switch f {
+		case "send":
+			mu.Lock()
+			msg := next
+			next++
+			mu.Unlock()
+
+			op.F = "send"
+			op.Key = keys[rng.IntN(len(keys))]
+			op.Msg = msg
+			reqBody = api.Send{
+				MessageBody: maelstrom.MessageBody{Type: "send"},
+				Key:         op.Key,
+				Msg:         &msg}
+		case "poll":
+			op.F = "poll"
+			op.Offsets = make(map[string]int)
+			for _, key := range keys {
+				op.Offsets[key] = rng.IntN(pollStart(polled, &mu, key) + 1)
+			}
+			reqBody = api.Poll{
+				MessageBody: maelstrom.MessageBody{Type: "poll"},
+				Offsets:     op.Offsets}
+		case "commit_offsets":
+			mu.Lock()
+			op.F = "commit_offsets"
+			op.Offsets = maps.Clone(polled)
+			mu.Unlock()
+			reqBody = api.CommitOffsets{
+				MessageBody: maelstrom.MessageBody{Type: "commit_offsets"},
+				Offsets:     op.Offsets}
+		case "list_committed_offsets":
+			op.F = "list_committed_offsets"
+			reqBody = api.ListCommittedOffsets{
+				MessageBody: maelstrom.MessageBody{Type: "list_committed_offsets"},
+				Keys:        keys}
+		}
+
+		op.Invoke = r.nw.Now()
+		res, err := r.request(c, node, reqBody)
+		op.Complete = r.nw.Now()
+		op.OK = err == nil
+		if err == nil {
+			err = decodeKafka(&op, res)
+			op.OK = err == nil
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		h.Ops = append(h.Ops, op)
+		if op.OK && op.F == "poll" {
+			for key, pairs := range op.Msgs {
+				if last := len(pairs) - 1; last >= 0 && len(pairs[last]) == 2 {
+					polled[key] = max(polled[key], int(pairs[last][0]))
+				}
+			}
+		}
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := r.writeHistory(h); err != nil {
+		return err
+	}
+
+	res := checker.CheckKafka(h)
+	for _, fault := range res.Faults {
+		fmt.Println(fault)
+	}
+	for _, kind := range slices.Sorted(maps.Keys(res.Counts)) {
+		fmt.Printf("%s: %d\n", kind, res.Counts[kind])
+	}
+	fmt.Printf("kafka: %d ops\n", len(h.Ops))
+	if !res.Valid {
+		return errors.New("kafka history has faults")
+	}
+	return nil
+}
+
+// pollStart returns the highest offset polled from key so far, polls start
+// anywhere up to it.
+func pollStart(polled map[string]int, mu *sync.Mutex, key string) int {
+	mu.Lock()
+	defer mu.Unlock()
+	return polled[key]
+}
+
+func decodeKafka(op *checker.KafkaOp, res maelstrom.Message) error {
+	switch op.F {
+	case "send":
+		resBody, err := api.Decode[api.SendOK](res)
+		op.Offset = resBody.Offset
+		return err
+	case "poll":
+		resBody, err := api.Decode[api.PollOK](res)
+		op.Msgs = resBody.Msgs
+		return err
+	case "list_committed_offsets":
+		resBody, err := api.Decode[api.ListCommittedOffsetsOK](res)
+		op.Offsets = resBody.Offsets
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// Command tracestitch reads the span files written by the nodes (see
+// package trace) from a directory and prints one causal tree per client
+// operation. Internal spans linking to a span, e.g. a batch flushing a
+// buffered value, are printed under it as well, indented with "~".
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"common/trace"
+)
+
+func main() {
+	dir := "."
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var spans []trace.Span
+	for _, path := range paths {
+		s, err := readSpans(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		spans = append(spans, s...)
+	}
+	slices.SortFunc(spans, func(a, b trace.Span) int {
+		return a.Start.Compare(b.Start)
+	})
+
+	children := make(map[string][]trace.Span)
+	linked := make(map[string][]trace.Span)
+	for _, span := range spans {
+		if span.ParentID != "" {
+			children[span.ParentID] = append(children[span.ParentID], span)
+		}
+		for _, link := range span.Links {
+			linked[link.SpanID] = append(linked[link.SpanID], span)
+		}
+	}
+
+	for _, span := range spans {
+		// client operations are the requests without a parent coming from
+		// outside the cluster
+		if span.ParentID != "" || span.Kind != "server" || strings.HasPrefix(span.Peer, "n") {
+			continue
+		}
+		fmt.Printf("trace %s\n", span.TraceID)
+		printTree(span, "", children, linked, make(map[string]bool))
+	}
+}
+
+func printTree(span trace.Span, indent string, children, linked map[string][]trace.Span, seen map[string]bool) {
+	if seen[span.SpanID] {
+		return
+	}
+	seen[span.SpanID] = true
+
+	line := fmt.Sprintf("%s%s %s %s", indent, span.Node, span.Kind, span.Name)
+	if span.Peer != "" {
+		line += " peer=" + span.Peer
+	}
+	line += fmt.Sprintf(" took=%s", span.End.Sub(span.Start))
+	if span.Error != "" {
+		line += " error=" + span.Error
+	}
+	fmt.Println(line)
+
+	for _, child := range children[span.SpanID] {
+		printTree(child, indent+"  ", children, linked, seen)
+	}
+	for _, l := range linked[span.SpanID] {
+		printTree(l, indent+"~ ", children, linked, seen)
+	}
+}
+
+func readSpans(path string) ([]trace.Span, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var spans []trace.Span
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var span trace.Span
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		spans = append(spans, span)
+	}
+	return spans, scanner.Err()
+}
@@ -0,0 +1,268 @@
+// Package config holds the tuning knobs of the challenges: timeouts, retry
+// backoff, intervals and topology constants. Each one is read, in order of
+// precedence, from a command-line flag, a GLOMERS_* environment variable,
+// a JSON file given by -config or GLOMERS_CONFIG, or the challenge's
+// default.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// deadline of a single attempt of an RPC to another node
+	RPCTimeout time.Duration
+	// deadline of the first attempt of a retried RPC, multiplied by
+	// RetryFactor after every failed attempt
+	RetryBase   time.Duration
+	RetryFactor int
+	// how often buffered values are flushed to the neighbors
+	BroadcastInterval time.Duration
+	// deadline of a single request to a KV service
+	KVTimeout time.Duration
+	// strategy of package topology the broadcast nodes pick neighbors with
+	Topology string
+	// hub of the star topology and root of the tree
+	CentralNode string
+	// number of children of a node in the tree topology
+	TreeFanout int
+	// number of chords in each direction in the ring topology
+	RingChords int
+	// RPCs timed out in a row after which the star's hub is replaced
+	HubFailures int
+	// how often a replaced hub is probed to see if it's back
+	HubRecheck time.Duration
+	// how often a node compares its values with a peer, 0 for never
+	AntiEntropyInterval time.Duration
+	// how often a broadcast node gossips, 0 for following the topology
+	GossipInterval time.Duration
+	// number of random peers a node gossips with each round
+	GossipFanout int
+	// share of those peers that get pushed to rather than pulled from
+	GossipPushRatio float64
+	// how often a Plumtree node announces values to its lazy peers, 0 for
+	// not running Plumtree
+	PlumtreeInterval time.Duration
+	// how long an announced value may be missing before it's grafted
+	GraftTimeout time.Duration
+	// number of dense IDs a node leases at once
+	IDBlockSize int
+	// how often peers are probed by the failure detector, 0 for never
+	ProbeInterval time.Duration
+	// least time a probe has to be answered, more for peers whose replies
+	// take longer
+	ProbeTimeout time.Duration
+	// suspicion level above which a peer counts as down
+	PhiThreshold float64
+}
+
+// Defaults returns the values the challenges were tuned with.
+func Defaults() Config {
+	return Config{
+		RPCTimeout:          100 * time.Millisecond,
+		RetryBase:           250 * time.Millisecond,
+		RetryFactor:         2,
+		BroadcastInterval:   100 * time.Millisecond,
+		KVTimeout:           1000 * time.Millisecond,
+		Topology:            "maelstrom",
+		CentralNode:         "n0",
+		TreeFanout:          4,
+		RingChords:          2,
+		HubFailures:         2,
+		HubRecheck:          500 * time.Millisecond,
+		AntiEntropyInterval: time.Second,
+		GossipFanout:        3,
+		GossipPushRatio:     0.5,
+		GraftTimeout:        500 * time.Millisecond,
+		IDBlockSize:         1000,
+		ProbeTimeout:        time.Second,
+		PhiThreshold:        8}
+}
+
+// flags registers every knob of c on fs under its flag name, which is also
+// the key in the JSON file and, upper-cased with dashes turned into
+// underscores and prefixed with GLOMERS_, the environment variable.
+func (c *Config) flags(fs *flag.FlagSet) {
+	fs.DurationVar(&c.RPCTimeout, "rpc-timeout", c.RPCTimeout, "deadline of a single RPC attempt")
+	fs.DurationVar(&c.RetryBase, "retry-base", c.RetryBase, "deadline of the first attempt of a retried RPC")
+	fs.IntVar(&c.RetryFactor, "retry-factor", c.RetryFactor, "multiplier of the deadline after a failed attempt")
+	fs.DurationVar(&c.BroadcastInterval, "broadcast-interval", c.BroadcastInterval, "interval of flushing buffered values")
+	fs.DurationVar(&c.KVTimeout, "kv-timeout", c.KVTimeout, "deadline of a single KV request")
+	fs.StringVar(&c.Topology, "topology", c.Topology, "neighbors of the broadcast nodes: maelstrom, star, tree, grid, ring or mesh")
+	fs.StringVar(&c.CentralNode, "central-node", c.CentralNode, "hub of the star topology and root of the tree")
+	fs.IntVar(&c.TreeFanout, "tree-fanout", c.TreeFanout, "number of children of a node in the tree topology")
+	fs.IntVar(&c.RingChords, "ring-chords", c.RingChords, "number of chords in each direction in the ring topology")
+	fs.IntVar(&c.HubFailures, "hub-failures", c.HubFailures, "RPCs timed out in a row after which the hub is replaced")
+	fs.DurationVar(&c.HubRecheck, "hub-recheck", c.HubRecheck, "interval of probing a replaced hub")
+	fs.DurationVar(&c.AntiEntropyInterval, "anti-entropy-interval", c.AntiEntropyInterval, "interval of comparing values with a peer, 0 for never")
+	fs.DurationVar(&c.GossipInterval, "gossip-interval", c.GossipInterval, "interval of gossip rounds, 0 for following the topology instead")
+	fs.IntVar(&c.GossipFanout, "gossip-fanout", c.GossipFanout, "number of random peers gossiped with each round")
+	fs.Float64Var(&c.GossipPushRatio, "gossip-push-ratio", c.GossipPushRatio, "share of the peers of a round that get pushed to rather than pulled from")
+	fs.DurationVar(&c.PlumtreeInterval, "plumtree-interval", c.PlumtreeInterval, "interval of announcing values to lazy peers, 0 for not running Plumtree")
+	fs.DurationVar(&c.GraftTimeout, "graft-timeout", c.GraftTimeout, "time an announced value may be missing before it's grafted")
+	fs.IntVar(&c.IDBlockSize, "id-block-size", c.IDBlockSize, "number of dense IDs leased at once")
+	fs.DurationVar(&c.ProbeInterval, "probe-interval", c.ProbeInterval, "interval of probing peers, 0 for never")
+	fs.DurationVar(&c.ProbeTimeout, "probe-timeout", c.ProbeTimeout, "least time a probe has to be answered")
+	fs.Float64Var(&c.PhiThreshold, "phi-threshold", c.PhiThreshold, "suspicion level of peers counting as down")
+}
+
+// Load returns def overridden from os.Args, the environment and the config
+// file.
+func Load(def Config) (Config, error) {
+	return load(def, os.Args[1:], os.Getenv)
+}
+
+func load(c Config, args []string, getenv func(string) string) (Config, error) {
+	fs := flag.NewFlagSet("glomers", flag.ContinueOnError)
+	c.flags(fs)
+	path := fs.String("config", getenv("GLOMERS_CONFIG"), "JSON file with config values")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	// flags given explicitly win over everything else
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	if *path != "" {
+		values, err := readFile(*path)
+		if err != nil {
+			return Config{}, err
+		}
+		for name, value := range values {
+			if fs.Lookup(name) == nil || name == "config" {
+				return Config{}, fmt.Errorf("%s: unknown key %q", *path, name)
+			}
+			if set[name] || getenv(envName(name)) != "" {
+				continue
+			}
+			if err := fs.Set(name, value); err != nil {
+				return Config{}, fmt.Errorf("%s: %s: %w", *path, name, err)
+			}
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value := getenv(envName(f.Name))
+		if err != nil || set[f.Name] || f.Name == "config" || value == "" {
+			return
+		}
+		if e := fs.Set(f.Name, value); e != nil {
+			err = fmt.Errorf("%s: %w", envName(f.Name), e)
+		}
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// readFile reads a JSON object of flag names to values, durations given as
+// strings, e.g. {"retry-base": "500ms", "retry-factor": 3}.
+func readFile(path string) (map[string]string, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// numbers are kept as written, fmt.Sprint of a float64 would turn
+	// 1000000 into 1e+06, which isn't a valid int flag
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("%s: trailing data after the object", path)
+	}
+
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		values[name] = fmt.Sprint(value)
+	}
+	return values, nil
+}
+
+func envName(flagName string) string {
+	return "GLOMERS_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Validate reports every knob of c that is out of range, joined into one
+// error, or nil if they all make sense.
+func (c Config) Validate() error {
+	var errs []error
+	durations := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"rpc-timeout", c.RPCTimeout},
+		{"retry-base", c.RetryBase},
+		{"broadcast-interval", c.BroadcastInterval},
+		{"kv-timeout", c.KVTimeout},
+		{"hub-recheck", c.HubRecheck},
+		{"probe-timeout", c.ProbeTimeout},
+		{"graft-timeout", c.GraftTimeout}}
+	for _, d := range durations {
+		if d.d <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", d.name, d.d))
+		}
+	}
+	if c.RetryFactor < 1 {
+		errs = append(errs, fmt.Errorf("retry-factor must be at least 1, got %d", c.RetryFactor))
+	}
+	if c.IDBlockSize < 1 {
+		errs = append(errs, fmt.Errorf("id-block-size must be at least 1, got %d", c.IDBlockSize))
+	}
+	if c.TreeFanout < 1 {
+		errs = append(errs, fmt.Errorf("tree-fanout must be at least 1, got %d", c.TreeFanout))
+	}
+	if c.RingChords < 0 {
+		errs = append(errs, fmt.Errorf("ring-chords must not be negative, got %d", c.RingChords))
+	}
+	if c.HubFailures < 1 {
+		errs = append(errs, fmt.Errorf("hub-failures must be at least 1, got %d", c.HubFailures))
+	}
+	if c.AntiEntropyInterval < 0 {
+		errs = append(errs, fmt.Errorf("anti-entropy-interval must not be negative, got %s", c.AntiEntropyInterval))
+	}
+	if c.GossipInterval < 0 {
+		errs = append(errs, fmt.Errorf("gossip-interval must not be negative, got %s", c.GossipInterval))
+	}
+	if c.GossipFanout < 1 {
+		errs = append(errs, fmt.Errorf("gossip-fanout must be at least 1, got %d", c.GossipFanout))
+	}
+	if c.GossipPushRatio < 0 || c.GossipPushRatio > 1 {
+		errs = append(errs, fmt.Errorf("gossip-push-ratio must be between 0 and 1, got %g", c.GossipPushRatio))
+	}
+	if c.PlumtreeInterval < 0 {
+		errs = append(errs, fmt.Errorf("plumtree-interval must not be negative, got %s", c.PlumtreeInterval))
+	}
+	if c.GossipInterval > 0 && c.PlumtreeInterval > 0 {
+		errs = append(errs, errors.New("gossip-interval and plumtree-interval must not both be set"))
+	}
+	if c.ProbeInterval < 0 {
+		errs = append(errs, fmt.Errorf("probe-interval must not be negative, got %s", c.ProbeInterval))
+	}
+	if c.PhiThreshold <= 0 {
+		errs = append(errs, fmt.Errorf("phi-threshold must be positive, got %g", c.PhiThreshold))
+	}
+	if c.CentralNode == "" {
+		errs = append(errs, errors.New("central-node must not be empty"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `{"retry-base": "500ms", "retry-factor": 3, "kv-timeout": "2s"}`)
+	env := map[string]string{
+		"GLOMERS_CONFIG":       path,
+		"GLOMERS_RETRY_FACTOR": "4",
+		"GLOMERS_KV_TIMEOUT":   "3s"}
+	args := []string{"-kv-timeout", "4s"}
+
+	c, err := load(Defaults(), args, func(name string) string {
+		return env[name]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// file over default, env over file, flag over env
+	if c.RetryBase != 500*time.Millisecond {
+		t.Errorf("RetryBase = %s, want 500ms from the file", c.RetryBase)
+	}
+	if c.RetryFactor != 4 {
+		t.Errorf("RetryFactor = %d, want 4 from the environment", c.RetryFactor)
+	}
+	if c.KVTimeout != 4*time.Second {
+		t.Errorf("KVTimeout = %s, want 4s from the flag", c.KVTimeout)
+	}
+	if c.RPCTimeout != Defaults().RPCTimeout {
+		t.Errorf("RPCTimeout = %s, want the default", c.RPCTimeout)
+	}
+}
+
+func TestLoadFileNumbers(t *testing.T) {
+	path := writeConfig(t, `{"id-block-size": 1000000, "gossip-push-ratio": 0.25, "phi-threshold": 12}`)
+
+	c, err := load(Defaults(), []string{"-config", path}, func(string) string {
+		return ""
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.IDBlockSize != 1000000 {
+		t.Errorf("IDBlockSize = %d, want 1000000", c.IDBlockSize)
+	}
+	if c.GossipPushRatio != 0.25 {
+		t.Errorf("GossipPushRatio = %g, want 0.25", c.GossipPushRatio)
+	}
+	if c.PhiThreshold != 12 {
+		t.Errorf("PhiThreshold = %g, want 12", c.PhiThreshold)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		args []string
+		want string
+	}{
+		{"unknown key", `{"retry-bsae": "1s"}`, nil, `unknown key "retry-bsae"`},
+		{"bad value", `{"retry-factor": 1.5}`, nil, "retry-factor"},
+		{"trailing data", `{"retry-factor": 3} {}`, nil, "trailing data"},
+		{"invalid", `{}`, []string{"-retry-factor", "0"}, "retry-factor must be at least 1"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-config", writeConfig(t, tt.file)}, tt.args...)
+			_, err := load(Defaults(), args, func(string) string {
+				return ""
+			})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
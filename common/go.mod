@@ -0,0 +1,5 @@
+module common
+
+go 1.24.5
+
+require github.com/jepsen-io/maelstrom/demo/go v0.0.0-20250806145204-447d18a7c07e
@@ -0,0 +1,148 @@
+// Package gossip spreads broadcast values epidemically instead of along a
+// fixed topology. Every interval a node picks fanout random peers out of
+// all nodes. Each of them is, with probability pushRatio, pushed the values
+// the node learned since the previous round in a fire-and-forget gossip
+// message, and otherwise pulled from with an anti-entropy round (see
+// package antientropy), which brings over what the node is missing and
+// hands the peer what it lacks. Pushed values are new to the receiver as
+// well, so it pushes them on in its next round, and pulls catch whatever
+// the pushes missed. No node is special, so the values get through as long
+// as the nodes are connected now and then, whichever ones are cut off.
+package gossip
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"common/antientropy"
+	"common/clock"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+type Gossiper struct {
+	node      *maelstrom.Node
+	clock     clock.Clock
+	set       *antientropy.Set
+	syncer    *antientropy.Syncer
+	interval  time.Duration
+	fanout    int
+	pushRatio float64
+	mu        sync.Mutex
+	// values learned since the last round
+	fresh  []float64
+	rounds int
+	// closed by Stop
+	stop chan struct{}
+}
+
+type gossipBody struct {
+	Type   string    `json:"type"`
+	Values []float64 `json:"values"`
+}
+
+// New returns a gossiper spreading the values of set, pulling with syncer.
+// A pull has until the next round to be answered.
+func New(n *maelstrom.Node, clk clock.Clock, set *antientropy.Set, syncer *antientropy.Syncer, interval time.Duration, fanout int, pushRatio float64) *Gossiper {
+	return &Gossiper{
+		node:      n,
+		clock:     clk,
+		set:       set,
+		syncer:    syncer,
+		interval:  interval,
+		fanout:    fanout,
+		pushRatio: pushRatio,
+		stop:      make(chan struct{})}
+}
+
+// Start gossips until Stop is called.
+func (g *Gossiper) Start() {
+	go g.gossipLoop()
+}
+
+// Stop ends the loop started by Start.
+func (g *Gossiper) Stop() {
+	close(g.stop)
+}
+
+// Add adds v to the set, to be pushed in the next round if it's new.
+func (g *Gossiper) Add(v float64) {
+	if !g.set.Add(v) {
+		return
+	}
+	g.mu.Lock()
+	g.fresh = append(g.fresh, v)
+	g.mu.Unlock()
+}
+
+// Rounds returns the number of rounds done so far.
+func (g *Gossiper) Rounds() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.rounds
+}
+
+func (g *Gossiper) gossipLoop() {
+	ticker := g.clock.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C():
+		}
+
+		g.mu.Lock()
+		fresh := g.fresh
+		g.fresh = nil
+		g.rounds++
+		g.mu.Unlock()
+
+		for _, peer := range g.peers() {
+			if rand.Float64() < g.pushRatio {
+				if len(fresh) > 0 {
+					g.node.Send(peer, gossipBody{
+						Type:   "gossip",
+						Values: fresh})
+				}
+				continue
+			}
+			go func() {
+				ctx, cancel := g.clock.WithTimeout(context.Background(), g.interval)
+				defer cancel()
+				g.syncer.Sync(ctx, peer)
+			}()
+		}
+	}
+}
+
+// peers returns up to fanout random nodes other than this one.
+func (g *Gossiper) peers() []string {
+	nodes := slices.DeleteFunc(slices.Clone(g.node.NodeIDs()), func(id string) bool {
+		return id == g.node.ID()
+	})
+	rand.Shuffle(len(nodes), func(i, j int) {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	})
+	return nodes[:min(g.fanout, len(nodes))]
+}
+
+// HandleGossip takes the values pushed by a peer, it isn't answered.
+func (g *Gossiper) HandleGossip(msg maelstrom.Message) error {
+	var body gossipBody
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+	added := g.set.AddAll(body.Values)
+	if len(added) > 0 {
+		g.mu.Lock()
+		g.fresh = append(g.fresh, added...)
+		g.mu.Unlock()
+	}
+	return nil
+}
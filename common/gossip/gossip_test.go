@@ -0,0 +1,101 @@
+//go:build go1.25
+
+package gossip
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"common/antientropy"
+	"common/sim"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestPushRatio(t *testing.T) {
+	const rounds = 100
+	tests := []struct {
+		ratio float64
+		// bounds of the pushes among the 400 peers picked
+		min, max int
+	}{
+		{0, 0, 0},
+		{0.25, 60, 140},
+		{0.5, 160, 240},
+		{1, 400, 400}}
+
+	for _, tt := range tests {
+		synctest.Test(t, func(t *testing.T) {
+			nw := sim.New(sim.Config{
+				Seed:    1,
+				Latency: sim.Latency{Base: 5 * time.Millisecond},
+				Wait:    synctest.Wait})
+			var g *Gossiper
+			for _, id := range []string{"n0", "n1", "n2", "n3", "n4"} {
+				n := maelstrom.NewNode()
+				set := antientropy.NewSet()
+				syncer := antientropy.New(n, nw.Clock(), set, 0, nil)
+				n.Handle("sync", syncer.HandleSync)
+				n.Handle("sync_values", syncer.HandleValues)
+				// every round picks all 4 peers
+				gossiper := New(n, nw.Clock(), set, syncer, 100*time.Millisecond, 4, tt.ratio)
+				n.Handle("gossip", gossiper.HandleGossip)
+				if id == "n0" {
+					g = gossiper
+				}
+				nw.AddNode(id, n)
+			}
+			if err := nw.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			var pushes, pulls int
+			nw.Observe(func(d sim.Delivery) {
+				if d.Msg.Src != "n0" {
+					return
+				}
+				var body struct {
+					Type  string `json:"type"`
+					Level int    `json:"level"`
+				}
+				json.Unmarshal(d.Msg.Body, &body)
+				switch {
+				case body.Type == "gossip":
+					pushes++
+				case body.Type == "sync" && body.Level == 0:
+					pulls++
+				}
+			})
+			g.Start()
+			// a fresh value for every round, so that every push is sent
+			for i := range rounds {
+				g.Add(float64(i))
+				nw.Advance(100 * time.Millisecond)
+			}
+			g.Stop()
+			nw.Drain()
+			nw.Close()
+
+			if g.Rounds() != rounds {
+				t.Errorf("ratio %.2f: %d rounds, want %d", tt.ratio, g.Rounds(), rounds)
+			}
+			if pushes < tt.min || pushes > tt.max {
+				t.Errorf("ratio %.2f: %d pushes, want %d to %d", tt.ratio, pushes, tt.min, tt.max)
+			}
+			if pushes+pulls != 4*rounds {
+				t.Errorf("ratio %.2f: %d pushes and %d pulls, want %d in all", tt.ratio, pushes, pulls, 4*rounds)
+			}
+		})
+	}
+}
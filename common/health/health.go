@@ -0,0 +1,284 @@
+// Package health probes the other nodes of the cluster and tells which of
+// them are likely down, using a phi accrual failure detector (Hayashibara
+// et al.). The suspicion level phi of a peer grows the longer it has been
+// silent compared to the usual interval between its probe replies; phi = 8
+// means the silence would be that long by chance with a probability of
+// 10^-8.
+package health
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"common/api"
+	"common/clock"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+const (
+	// probe replies sampled for the interval and RTT statistics
+	window = 100
+	maxPhi = 100
+	// multiple of the slowest RTT of a peer its probes have to be answered
+	// in, so that a high latency doesn't make every probe time out
+	rttSlack = 3
+)
+
+type Detector struct {
+	node  *maelstrom.Node
+	clock clock.Clock
+	// 0 disables probing, phi then stays 0 for all peers
+	interval  time.Duration
+	timeout   time.Duration
+	threshold float64
+	mu        sync.Mutex
+	started   time.Time
+	peers     map[string]*peer
+	// closed by Stop
+	stop chan struct{}
+}
+
+type peer struct {
+	// intervals between probe replies and the RTTs of the probes, in ms
+	intervals []float64
+	rtts      []float64
+	last      time.Time
+	sent      int
+	lost      int
+}
+
+// PeerStats is what the detector knows about a peer.
+type PeerStats struct {
+	Phi       float64 `json:"phi"`
+	Suspected bool    `json:"suspected"`
+	// mean and max RTT of the last probes, in ms
+	RTTMean float64 `json:"rtt_mean"`
+	RTTMax  float64 `json:"rtt_max"`
+	Sent    int     `json:"sent"`
+	Lost    int     `json:"lost"`
+	// ms since the last probe reply, -1 if none came yet
+	SinceLast float64 `json:"since_last"`
+}
+
+type probeBody struct {
+	Type string `json:"type"`
+}
+
+type peersOK struct {
+	Type  string               `json:"type"`
+	Peers map[string]PeerStats `json:"peers"`
+}
+
+// New returns a detector probing every peer of n each interval, a probe
+// being lost if it isn't answered within timeout, or within a few times
+// the slowest RTT seen from the peer if that's longer. Peers with phi
+// above threshold are suspected.
+func New(n *maelstrom.Node, clk clock.Clock, interval, timeout time.Duration, threshold float64) *Detector {
+	return &Detector{
+		node:      n,
+		clock:     clk,
+		interval:  interval,
+		timeout:   timeout,
+		threshold: threshold,
+		peers:     make(map[string]*peer),
+		stop:      make(chan struct{})}
+}
+
+// Start probes the peers until Stop is called, doing nothing if probing
+// is disabled. Probes start once the node got its init message.
+func (d *Detector) Start() {
+	if d.interval <= 0 {
+		return
+	}
+	go d.probeLoop()
+}
+
+// Stop ends the loop started by Start.
+func (d *Detector) Stop() {
+	close(d.stop)
+}
+
+func (d *Detector) probeLoop() {
+	ticker := d.clock.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C():
+		}
+
+		for _, id := range d.node.NodeIDs() {
+			if id == d.node.ID() {
+				continue
+			}
+			go d.probe(id)
+		}
+	}
+}
+
+func (d *Detector) probe(id string) {
+	d.mu.Lock()
+	if d.started.IsZero() {
+		d.started = d.clock.Now()
+	}
+	p := d.peer(id)
+	p.sent++
+	timeout := d.timeout
+	if len(p.rtts) > 0 {
+		rtt := time.Duration(slices.Max(p.rtts) * float64(time.Millisecond))
+		timeout = max(timeout, rttSlack*rtt)
+	}
+	d.mu.Unlock()
+
+	ctx, cancel := d.clock.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := d.clock.Now()
+	_, err := api.SyncRPC(ctx, d.node, id, probeBody{
+		Type: "probe"})
+	now := d.clock.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err != nil {
+		p.lost++
+		return
+	}
+
+	p.rtts = appendSample(p.rtts, float64(now.Sub(start))/float64(time.Millisecond))
+	if p.last.IsZero() {
+		// bootstrap the statistics with the expected interval
+		p.intervals = appendSample(p.intervals, float64(d.interval)/float64(time.Millisecond))
+	} else if now.After(p.last) {
+		p.intervals = appendSample(p.intervals, float64(now.Sub(p.last))/float64(time.Millisecond))
+	}
+	if now.After(p.last) {
+		p.last = now
+	}
+}
+
+func (d *Detector) peer(id string) *peer {
+	p, ok := d.peers[id]
+	if !ok {
+		p = &peer{}
+		d.peers[id] = p
+	}
+	return p
+}
+
+func appendSample(samples []float64, sample float64) []float64 {
+	if len(samples) == window {
+		samples = samples[1:]
+	}
+	return append(samples, sample)
+}
+
+// Phi returns the suspicion level of a peer, 0 for unknown peers.
+func (d *Detector) Phi(id string) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.phi(id, d.clock.Now())
+}
+
+func (d *Detector) phi(id string, now time.Time) float64 {
+	p, ok := d.peers[id]
+	if !ok {
+		return 0
+	}
+
+	intervals := p.intervals
+	last := p.last
+	if last.IsZero() {
+		// never answered, count the silence from the first probe
+		intervals = []float64{float64(d.interval) / float64(time.Millisecond)}
+		last = d.started
+	}
+
+	mean, std := meanStd(intervals)
+	// jitter of a few ms mustn't make a peer suspicious right away
+	std = max(std, mean/4)
+	return phi(float64(now.Sub(last))/float64(time.Millisecond), mean, std)
+}
+
+// phi is -log10 of the probability that a reply comes later than elapsed,
+// with the normal CDF approximated by a logistic function. It's capped at
+// maxPhi, where the probability underflows.
+func phi(elapsed, mean, std float64) float64 {
+	y := (elapsed - mean) / std
+	e := math.Exp(-y * (1.5976 + 0.070566*y*y))
+	if elapsed > mean {
+		return min(-math.Log10(e/(1+e)), maxPhi)
+	}
+	return -math.Log10(1 - 1/(1+e))
+}
+
+func meanStd(samples []float64) (float64, float64) {
+	var sum float64
+	for _, s := range samples {
+		sum += s
+	}
+	mean := sum / float64(len(samples))
+
+	var sq float64
+	for _, s := range samples {
+		sq += (s - mean) * (s - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(samples)))
+}
+
+// Suspected reports whether a peer is likely down.
+func (d *Detector) Suspected(id string) bool {
+	return d.Phi(id) > d.threshold
+}
+
+// Alive returns the peers among ids that aren't suspected, in order.
+func (d *Detector) Alive(ids []string) []string {
+	return slices.DeleteFunc(slices.Clone(ids), d.Suspected)
+}
+
+// Stats returns what the detector knows about every peer it probed.
+func (d *Detector) Stats() map[string]PeerStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	stats := make(map[string]PeerStats, len(d.peers))
+	for id, p := range d.peers {
+		s := PeerStats{
+			Phi:       d.phi(id, now),
+			Sent:      p.sent,
+			Lost:      p.lost,
+			SinceLast: -1}
+		s.Suspected = s.Phi > d.threshold
+		if len(p.rtts) > 0 {
+			s.RTTMean, _ = meanStd(p.rtts)
+			s.RTTMax = slices.Max(p.rtts)
+		}
+		if !p.last.IsZero() {
+			s.SinceLast = float64(now.Sub(p.last)) / float64(time.Millisecond)
+		}
+		stats[id] = s
+	}
+	return stats
+}
+
+// HandleProbe answers the probes of other nodes.
+func (d *Detector) HandleProbe(msg maelstrom.Message) error {
+	replyBody := probeBody{
+		Type: "probe_ok"}
+	return d.node.Reply(msg, replyBody)
+}
+
+// HandlePeers answers the "peers" RPC with the stats of every peer.
+func (d *Detector) HandlePeers(msg maelstrom.Message) error {
+	replyBody := peersOK{
+		Type:  "peers_ok",
+		Peers: d.Stats()}
+	return d.node.Reply(msg, replyBody)
+}
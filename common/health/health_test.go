@@ -0,0 +1,119 @@
+//go:build go1.25
+
+package health
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"common/sim"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newPair returns a network of n0 probing n1 every 100ms with a probe
+// timeout of 40ms and phi threshold 8, and the detector of n0.
+func newPair(t *testing.T, latency time.Duration) (*sim.Network, *Detector) {
+	nw := sim.New(sim.Config{
+		Seed:    1,
+		Latency: sim.Latency{Base: latency},
+		Wait:    synctest.Wait})
+	var detectors []*Detector
+	for i, id := range []string{"n0", "n1"} {
+		n := maelstrom.NewNode()
+		interval := 100 * time.Millisecond
+		if i == 1 {
+			interval = 0
+		}
+		d := New(n, nw.Clock(), interval, 40*time.Millisecond, 8)
+		n.Handle("probe", d.HandleProbe)
+		nw.AddNode(id, n)
+		detectors = append(detectors, d)
+	}
+	if err := nw.Start(); err != nil {
+		t.Fatal(err)
+	}
+	detectors[0].Start()
+	t.Cleanup(func() {
+		detectors[0].Stop()
+		// let the probes in flight time out
+		nw.Advance(time.Second)
+		nw.Close()
+	})
+	return nw, detectors[0]
+}
+
+func TestPhi(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		nw, d := newPair(t, 5*time.Millisecond)
+
+		nw.Advance(2 * time.Second)
+		if phi := d.Phi("n1"); phi > 1 {
+			t.Errorf("phi %.2f while n1 answers, want at most 1", phi)
+		}
+
+		nw.Isolate("n1")
+		nw.Advance(time.Second)
+		if phi := d.Phi("n1"); phi <= 8 {
+			t.Errorf("phi %.2f after a second of missed probes, want above 8", phi)
+		}
+		if alive := d.Alive([]string{"n0", "n1"}); len(alive) != 1 || alive[0] != "n0" {
+			t.Errorf("alive %v, want [n0]", alive)
+		}
+
+		nw.Heal()
+		nw.Advance(time.Second)
+		if d.Suspected("n1") {
+			t.Errorf("n1 still suspected with phi %.2f once it answers again", d.Phi("n1"))
+		}
+		stats := d.Stats()["n1"]
+		if stats.Lost == 0 || stats.Lost == stats.Sent {
+			t.Errorf("%d of %d probes lost, want some", stats.Lost, stats.Sent)
+		}
+	})
+}
+
+func TestRTTSlack(t *testing.T) {
+	tests := []struct {
+		name    string
+		latency time.Duration
+		lost    bool
+	}{
+		// RTT 50ms, above the timeout but within 3 times the RTT of 20ms
+		// seen so far
+		{"within slack", 25 * time.Millisecond, false},
+		// RTT 80ms, beyond 3 times 20ms
+		{"beyond slack", 40 * time.Millisecond, true}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			synctest.Test(t, func(t *testing.T) {
+				nw, d := newPair(t, 10*time.Millisecond)
+				// change the latency between two probes, not while one is in flight
+				nw.Advance(time.Second + 50*time.Millisecond)
+
+				nw.SetLatency("n0", "n1", sim.Latency{Base: tt.latency})
+				nw.SetLatency("n1", "n0", sim.Latency{Base: tt.latency})
+				nw.Advance(time.Second)
+
+				stats := d.Stats()["n1"]
+				if lost := stats.Lost > 0; lost != tt.lost {
+					t.Errorf("%d of %d probes lost, want lost %v", stats.Lost, stats.Sent, tt.lost)
+				}
+				if !tt.lost && stats.RTTMax != float64(2*tt.latency/time.Millisecond) {
+					t.Errorf("max RTT %.0fms, want %dms", stats.RTTMax, 2*tt.latency/time.Millisecond)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package history
+
+import (
+	"encoding/json"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// EDN formats op as a Jepsen operation map, e.g.
+//
+//	{:type :ok, :f :read, :value [1 2], :process 3, :time 1700000000000000000, :node "n0"}
+//
+// The values of sends and polls are written as the micro-operations of
+// Jepsen's kafka workload, which Elle's checker reads, e.g.
+//
+//	{:type :ok, :f :send, :value [[:send "k" [3 42]]], ...}
+//	{:type :ok, :f :poll, :value [[:poll {"k" [[3 42] [4 43]]}]], ...}
+//
+// The workload has no counterpart of commit_offsets and
+// list_committed_offsets, their values stay maps of fields.
+func EDN(op Op) string {
+	var b strings.Builder
+	b.WriteString("{:type :")
+	b.WriteString(op.Type)
+	b.WriteString(", :f :")
+	b.WriteString(op.F)
+	b.WriteString(", :value ")
+	writeEDN(&b, microOps(op))
+	b.WriteString(", :process ")
+	b.WriteString(strconv.Itoa(op.Process))
+	b.WriteString(", :time ")
+	b.WriteString(strconv.FormatInt(op.Time, 10))
+	b.WriteString(", :node ")
+	b.WriteString(strconv.Quote(op.Node))
+	if op.Error != "" {
+		b.WriteString(", :error ")
+		b.WriteString(strconv.Quote(op.Error))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// keyword is written as an EDN keyword.
+type keyword string
+
+// microOps returns the value of a send or poll as a vector of kafka
+// micro-operations, and any other value as it is. A send that got an
+// offset is [[:send key [offset msg]]], one that didn't [[:send key msg]].
+// A poll that got messages is [[:poll {key [[offset msg] ...]}]], one that
+// didn't [[:poll]].
+func microOps(op Op) any {
+	fields, _ := op.Value.(Fields)
+	switch op.F {
+	case "send":
+		msg := fields["msg"]
+		if offset, ok := fields["offset"]; ok {
+			msg = []any{offset, msg}
+		}
+		return []any{[]any{keyword("send"), fields["key"], msg}}
+	case "poll":
+		if msgs, ok := fields["msgs"]; ok {
+			return []any{[]any{keyword("poll"), msgs}}
+		}
+		return []any{[]any{keyword("poll")}}
+	}
+	return op.Value
+}
+
+// writeEDN writes the values decoded from JSON bodies. Keys of Fields
+// become keywords, keys of other maps (keys of the log, node IDs) stay
+// strings.
+func writeEDN(b *strings.Builder, v any) {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("nil")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			b.WriteString(strconv.FormatInt(int64(v), 10))
+		} else {
+			b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	case string:
+		b.WriteString(strconv.Quote(v))
+	case keyword:
+		b.WriteString(":" + string(v))
+	case []any:
+		b.WriteString("[")
+		for i, elem := range v {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			writeEDN(b, elem)
+		}
+		b.WriteString("]")
+	case Fields:
+		b.WriteString("{")
+		for i, key := range slices.Sorted(maps.Keys(v)) {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(":" + key + " ")
+			writeEDN(b, v[key])
+		}
+		b.WriteString("}")
+	case map[string]any:
+		b.WriteString("{")
+		for i, key := range slices.Sorted(maps.Keys(v)) {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(strconv.Quote(key) + " ")
+			writeEDN(b, v[key])
+		}
+		b.WriteString("}")
+	default:
+		// not produced from a JSON body, written as a JSON string
+		buf, _ := json.Marshal(v)
+		b.WriteString(strconv.Quote(string(buf)))
+	}
+}
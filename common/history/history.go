@@ -0,0 +1,261 @@
+// Package history records the operations clients perform on a node as a
+// Jepsen-style history: an :invoke entry when a request arrives and an
+// :ok, :fail or :info entry when the node answers it. Entries are written
+// to a per-node file as JSON lines, which Load reads back for the checkers
+// of package checker, or as EDN for Jepsen.
+//
+// Recording is enabled by setting GLOMERS_HISTORY_DIR, the format is chosen
+// by GLOMERS_HISTORY_FORMAT ("json", the default, or "edn").
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"common/clock"
+	"common/wire"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// Op is a single entry of a history.
+type Op struct {
+	// "invoke", "ok", "fail" or "info"
+	Type string `json:"type"`
+	// type of the request, e.g. "broadcast" or "poll"
+	F     string `json:"f"`
+	Value any    `json:"value"`
+	// number of the client, 3 for c3
+	Process int `json:"process"`
+	// nanoseconds since the Unix epoch
+	Time  int64  `json:"time"`
+	Node  string `json:"node"`
+	Error string `json:"error,omitempty"`
+}
+
+// Request types that get recorded, everything else is ignored.
+var recorded = map[string]bool{
+	"broadcast":              true,
+	"read":                   true,
+	"add":                    true,
+	"send":                   true,
+	"poll":                   true,
+	"commit_offsets":         true,
+	"list_committed_offsets": true}
+
+type Recorder struct {
+	node   *maelstrom.Node
+	clock  clock.Clock
+	dir    string
+	format string
+	mu     sync.Mutex
+	file   *os.File
+	// set if the file couldn't be opened, nothing more gets recorded
+	openErr error
+	// src:msg_id -> invocation waiting for its reply
+	pending map[string]Op
+}
+
+// FromEnv returns a recorder writing to GLOMERS_HISTORY_DIR in the format
+// of GLOMERS_HISTORY_FORMAT, disabled if the directory is unset.
+func FromEnv(n *maelstrom.Node, clk clock.Clock) *Recorder {
+	return New(n, clk, os.Getenv("GLOMERS_HISTORY_DIR"), os.Getenv("GLOMERS_HISTORY_FORMAT"))
+}
+
+// New returns a recorder writing the operations of n to <dir>/<node ID>.jsonl
+// or, with the "edn" format, <dir>/<node ID>.edn. It's disabled if dir is
+// empty. n must not be running yet.
+func New(n *maelstrom.Node, clk clock.Clock, dir, format string) *Recorder {
+	r := &Recorder{
+		node:    n,
+		clock:   clk,
+		dir:     dir,
+		format:  format,
+		pending: make(map[string]Op)}
+	if format != "" && format != "json" && format != "edn" {
+		log.Printf("history: unknown format %q, using json", format)
+		r.format = "json"
+	}
+	if dir == "" {
+		return r
+	}
+
+	wire.OnReceive(n, r.invoke)
+	wire.OnSend(n, r.complete)
+	return r
+}
+
+func (r *Recorder) Enabled() bool {
+	return r.dir != ""
+}
+
+// Close completes the operations still waiting for a reply with :info and
+// closes the file.
+func (r *Recorder) Close() {
+	if !r.Enabled() {
+		return
+	}
+
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[string]Op)
+	r.mu.Unlock()
+
+	for _, op := range pending {
+		op.Type = "info"
+		op.Time = r.clock.Now().UnixNano()
+		op.Error = "no reply before shutdown"
+		r.write(op)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
+
+func (r *Recorder) invoke(msg maelstrom.Message) {
+	if !isClient(msg.Src) || !recorded[msg.Type()] {
+		return
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return
+	}
+	process, _ := strconv.Atoi(msg.Src[1:])
+	op := Op{
+		Type:    "invoke",
+		F:       msg.Type(),
+		Value:   invokeValue(msg.Type(), body),
+		Process: process,
+		Time:    r.clock.Now().UnixNano(),
+		Node:    msg.Dest}
+
+	r.mu.Lock()
+	r.pending[fmt.Sprintf("%s:%v", msg.Src, body["msg_id"])] = op
+	r.mu.Unlock()
+
+	r.write(op)
+}
+
+func (r *Recorder) complete(msg maelstrom.Message) {
+	if !isClient(msg.Dest) {
+		return
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return
+	}
+	key := fmt.Sprintf("%s:%v", msg.Dest, body["in_reply_to"])
+
+	r.mu.Lock()
+	op, ok := r.pending[key]
+	delete(r.pending, key)
+	r.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	op.Time = r.clock.Now().UnixNano()
+	if msg.Type() == "error" {
+		// only timeouts and crashes may have taken effect anyway
+		code, _ := body["code"].(float64)
+		op.Type = "fail"
+		if int(code) == maelstrom.Timeout || int(code) == maelstrom.Crash {
+			op.Type = "info"
+		}
+		op.Error, _ = body["text"].(string)
+	} else {
+		op.Type = "ok"
+		op.Value = okValue(op.F, op.Value, body)
+	}
+	r.write(op)
+}
+
+func isClient(id string) bool {
+	return strings.HasPrefix(id, "c")
+}
+
+// Fields is a value made of named fields, written with keyword keys in EDN.
+type Fields map[string]any
+
+func invokeValue(f string, body map[string]any) any {
+	switch f {
+	case "broadcast":
+		return body["message"]
+	case "add":
+		return body["delta"]
+	case "send":
+		return Fields{"key": body["key"], "msg": body["msg"]}
+	case "poll", "commit_offsets":
+		return Fields{"offsets": body["offsets"]}
+	case "list_committed_offsets":
+		return Fields{"keys": body["keys"]}
+	}
+	return nil
+}
+
+// okValue fills the value of an invocation in with the reply, e.g. the
+// values returned by a read or the offset assigned to a send.
+func okValue(f string, value any, body map[string]any) any {
+	switch f {
+	case "read":
+		if messages, ok := body["messages"]; ok {
+			if messages == nil {
+				messages = []any{}
+			}
+			return messages
+		}
+		return body["value"]
+	case "send":
+		return Fields{"key": value.(Fields)["key"], "msg": value.(Fields)["msg"], "offset": body["offset"]}
+	case "poll":
+		return Fields{"offsets": value.(Fields)["offsets"], "msgs": body["msgs"]}
+	case "list_committed_offsets":
+		return Fields{"keys": value.(Fields)["keys"], "offsets": body["offsets"]}
+	}
+	return value
+}
+
+func (r *Recorder) write(op Op) {
+	var line []byte
+	if r.format == "edn" {
+		line = []byte(EDN(op))
+	} else {
+		buf, err := json.Marshal(op)
+		if err != nil {
+			log.Println(err.Error())
+			return
+		}
+		line = buf
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// the node ID is only known after init
+	if r.file == nil && r.openErr == nil {
+		ext := ".jsonl"
+		if r.format == "edn" {
+			ext = ".edn"
+		}
+		path := filepath.Join(r.dir, r.node.ID()+ext)
+		if r.file, r.openErr = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); r.openErr != nil {
+			log.Println(r.openErr.Error())
+		}
+	}
+	if r.file == nil {
+		return
+	}
+	r.file.Write(append(line, '\n'))
+}
@@ -0,0 +1,182 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"common/checker"
+	"common/clock"
+	"common/wire"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+var start = time.Unix(1700000000, 0)
+
+// record runs the requests of the clients (src, body) one after the other
+// against a node recording in format, and returns the recorded file. Every
+// handler takes a millisecond, and so does the pause after each reply.
+func record(t *testing.T, format string, requests [][2]string) string {
+	t.Helper()
+
+	clk := clock.NewFake(start)
+	n := maelstrom.NewNode()
+	n.Init("n0", []string{"n0"})
+	reply := func(body string) maelstrom.HandlerFunc {
+		return func(msg maelstrom.Message) error {
+			clk.Advance(time.Millisecond)
+			var v map[string]any
+			json.Unmarshal([]byte(body), &v)
+			return n.Reply(msg, v)
+		}
+	}
+	n.Handle("send", func(msg maelstrom.Message) error {
+		if strings.Contains(string(msg.Body), `"bad"`) {
+			clk.Advance(time.Millisecond)
+			return maelstrom.NewRPCError(maelstrom.TemporarilyUnavailable, "full")
+		}
+		return reply(`{"type": "send_ok", "offset": 3}`)(msg)
+	})
+	n.Handle("poll", reply(`{"type": "poll_ok", "msgs": {"k": [[3, 42]]}}`))
+	n.Handle("commit_offsets", reply(`{"type": "commit_offsets_ok"}`))
+	n.Handle("list_committed_offsets", reply(`{"type": "list_committed_offsets_ok", "offsets": {"k": 3}}`))
+	n.Handle("broadcast", reply(`{"type": "broadcast_ok"}`))
+	n.Handle("read", reply(`{"type": "read_ok", "messages": [5]}`))
+	n.Handle("topology", reply(`{"type": "topology_ok"}`))
+
+	inR, inW := io.Pipe()
+	n.Stdin = inR
+	n.Stdout = io.Discard
+	dir := t.TempDir()
+	r := New(n, clk, dir, format)
+	// tapped after the recorder, so a reply is only seen once recorded
+	replies := make(chan maelstrom.Message, 1)
+	wire.OnSend(n, func(msg maelstrom.Message) { replies <- msg })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := n.Run(); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	for i, req := range requests {
+		body := strings.Replace(req[1], "{", fmt.Sprintf(`{"msg_id": %d, `, i+1), 1)
+		fmt.Fprintf(inW, `{"src": %q, "dest": "n0", "body": %s}`+"\n", req[0], body)
+		select {
+		case <-replies:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no reply to %s", body)
+		}
+		clk.Advance(time.Millisecond)
+	}
+	inW.Close()
+	<-done
+	r.Close()
+
+	ext := ".jsonl"
+	if format == "edn" {
+		ext = ".edn"
+	}
+	buf, err := os.ReadFile(filepath.Join(dir, "n0"+ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+var requests = [][2]string{
+	{"c1", `{"type": "send", "key": "k", "msg": 42}`},
+	{"c2", `{"type": "send", "key": "bad", "msg": 1}`},
+	{"c1", `{"type": "poll", "offsets": {"k": 3}}`},
+	{"c2", `{"type": "commit_offsets", "offsets": {"k": 3}}`},
+	{"c1", `{"type": "list_committed_offsets", "keys": ["k"]}`},
+	{"c3", `{"type": "broadcast", "message": 5}`},
+	{"c3", `{"type": "read"}`},
+	// neither the node's own messages nor other types are recorded
+	{"n1", `{"type": "read"}`},
+	{"c3", `{"type": "topology", "topology": {}}`}}
+
+func ms(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+func TestJSON(t *testing.T) {
+	ops, err := Load(strings.NewReader(record(t, "json", requests)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 14 {
+		t.Fatalf("loaded %d ops, want 14", len(ops))
+	}
+	want := Op{
+		Type:    "invoke",
+		F:       "send",
+		Value:   map[string]any{"key": "k", "msg": 42.0},
+		Process: 1,
+		Time:    start.UnixNano(),
+		Node:    "n0"}
+	if !reflect.DeepEqual(ops[0], want) {
+		t.Errorf("first op %+v, want %+v", ops[0], want)
+	}
+
+	kafka := Kafka(ops)
+	wantKafka := checker.KafkaHistory{Ops: []checker.KafkaOp{
+		{Node: "n0", F: "send", Key: "k", Msg: 42, Offset: 3, Invoke: ms(0), Complete: ms(1), OK: true},
+		{Node: "n0", F: "send", Key: "bad", Msg: 1, Invoke: ms(2), Complete: ms(3)},
+		{Node: "n0", F: "poll", Offsets: map[string]int{"k": 3}, Msgs: map[string][][]float64{"k": {{3, 42}}}, Invoke: ms(4), Complete: ms(5), OK: true},
+		{Node: "n0", F: "commit_offsets", Offsets: map[string]int{"k": 3}, Invoke: ms(6), Complete: ms(7), OK: true},
+		{Node: "n0", F: "list_committed_offsets", Offsets: map[string]int{"k": 3}, Invoke: ms(8), Complete: ms(9), OK: true}}}
+	if !reflect.DeepEqual(kafka, wantKafka) {
+		t.Errorf("kafka history %+v, want %+v", kafka, wantKafka)
+	}
+
+	broadcast := Broadcast(ops)
+	wantBroadcast := checker.BroadcastHistory{
+		Nodes: []string{"n0"},
+		Ops: []checker.BroadcastOp{
+			{Node: "n0", F: "broadcast", Value: 5, Invoke: ms(10), Complete: ms(11), OK: true},
+			{Node: "n0", F: "read", Read: []float64{5}, Invoke: ms(12), Complete: ms(13), OK: true}}}
+	if !reflect.DeepEqual(broadcast, wantBroadcast) {
+		t.Errorf("broadcast history %+v, want %+v", broadcast, wantBroadcast)
+	}
+}
+
+func TestEDN(t *testing.T) {
+	got := strings.Split(strings.TrimSuffix(record(t, "edn", requests), "\n"), "\n")
+	at := func(ms int) int64 {
+		return start.Add(time.Duration(ms) * time.Millisecond).UnixNano()
+	}
+	want := []string{
+		fmt.Sprintf(`{:type :invoke, :f :send, :value [[:send "k" 42]], :process 1, :time %d, :node "n0"}`, at(0)),
+		fmt.Sprintf(`{:type :ok, :f :send, :value [[:send "k" [3 42]]], :process 1, :time %d, :node "n0"}`, at(1)),
+		fmt.Sprintf(`{:type :invoke, :f :send, :value [[:send "bad" 1]], :process 2, :time %d, :node "n0"}`, at(2)),
+		fmt.Sprintf(`{:type :fail, :f :send, :value [[:send "bad" 1]], :process 2, :time %d, :node "n0", :error "full"}`, at(3)),
+		fmt.Sprintf(`{:type :invoke, :f :poll, :value [[:poll]], :process 1, :time %d, :node "n0"}`, at(4)),
+		fmt.Sprintf(`{:type :ok, :f :poll, :value [[:poll {"k" [[3 42]]}]], :process 1, :time %d, :node "n0"}`, at(5)),
+		fmt.Sprintf(`{:type :invoke, :f :commit_offsets, :value {:offsets {"k" 3}}, :process 2, :time %d, :node "n0"}`, at(6)),
+		fmt.Sprintf(`{:type :ok, :f :commit_offsets, :value {:offsets {"k" 3}}, :process 2, :time %d, :node "n0"}`, at(7)),
+		fmt.Sprintf(`{:type :invoke, :f :list_committed_offsets, :value {:keys ["k"]}, :process 1, :time %d, :node "n0"}`, at(8)),
+		fmt.Sprintf(`{:type :ok, :f :list_committed_offsets, :value {:keys ["k"], :offsets {"k" 3}}, :process 1, :time %d, :node "n0"}`, at(9)),
+		fmt.Sprintf(`{:type :invoke, :f :broadcast, :value 5, :process 3, :time %d, :node "n0"}`, at(10)),
+		fmt.Sprintf(`{:type :ok, :f :broadcast, :value 5, :process 3, :time %d, :node "n0"}`, at(11)),
+		fmt.Sprintf(`{:type :invoke, :f :read, :value nil, :process 3, :time %d, :node "n0"}`, at(12)),
+		fmt.Sprintf(`{:type :ok, :f :read, :value [5], :process 3, :time %d, :node "n0"}`, at(13))}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
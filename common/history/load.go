@@ -0,0 +1,209 @@
+package history
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"common/checker"
+)
+
+// Load reads a history written in the JSON format.
+func Load(r io.Reader) ([]Op, error) {
+	var ops []Op
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var op Op
+		if err := json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ops = append(ops, op)
+	}
+	return ops, scanner.Err()
+}
+
+// pair is an invocation together with its completion, which is missing if
+// the node never answered.
+type pair struct {
+	invoke     Op
+	completion *Op
+}
+
+// pairs matches the invocations of ops from any number of nodes with their
+// completions. Times are made relative to the earliest entry.
+func pairs(ops []Op) ([]pair, int64) {
+	ops = slices.Clone(ops)
+	slices.SortStableFunc(ops, func(a, b Op) int {
+		return cmp.Compare(a.Time, b.Time)
+	})
+
+	var start int64
+	if len(ops) > 0 {
+		start = ops[0].Time
+	}
+
+	type process struct {
+		node string
+		id   int
+	}
+	var res []pair
+	// process -> index of its invocation waiting for a completion
+	open := make(map[process]int)
+	for _, op := range ops {
+		p := process{op.Node, op.Process}
+		if op.Type == "invoke" {
+			open[p] = len(res)
+			res = append(res, pair{invoke: op})
+			continue
+		}
+		if i, ok := open[p]; ok {
+			res[i].completion = &op
+			delete(open, p)
+		}
+	}
+	return res, start
+}
+
+func (p pair) times(start int64) (time.Duration, time.Duration, bool) {
+	invoke := time.Duration(p.invoke.Time - start)
+	if p.completion == nil {
+		return invoke, invoke, false
+	}
+	return invoke, time.Duration(p.completion.Time - start), p.completion.Type == "ok"
+}
+
+// okValue returns the value of the completion, nil unless it's an :ok.
+func (p pair) okValue() any {
+	if p.completion == nil || p.completion.Type != "ok" {
+		return nil
+	}
+	return p.completion.Value
+}
+
+// Broadcast turns the broadcast and read operations of ops into a history
+// for checker.CheckBroadcast. Nodes are the ones seen in ops; messages
+// between the nodes aren't recorded, so the network statistics stay empty.
+func Broadcast(ops []Op) checker.BroadcastHistory {
+	ps, start := pairs(ops)
+	var h checker.BroadcastHistory
+	for _, p := range ps {
+		if !slices.Contains(h.Nodes, p.invoke.Node) {
+			h.Nodes = append(h.Nodes, p.invoke.Node)
+		}
+
+		op := checker.BroadcastOp{
+			Node: p.invoke.Node,
+			F:    p.invoke.F}
+		op.Invoke, op.Complete, op.OK = p.times(start)
+		switch p.invoke.F {
+		case "broadcast":
+			op.Value, _ = p.invoke.Value.(float64)
+		case "read":
+			op.Read = floats(p.okValue())
+		default:
+			continue
+		}
+		h.Ops = append(h.Ops, op)
+	}
+	slices.Sort(h.Nodes)
+	return h
+}
+
+// Kafka turns the send, poll, commit_offsets and list_committed_offsets
+// operations of ops into a history for checker.CheckKafka.
+func Kafka(ops []Op) checker.KafkaHistory {
+	ps, start := pairs(ops)
+	var h checker.KafkaHistory
+	for _, p := range ps {
+		op := checker.KafkaOp{
+			Node: p.invoke.Node,
+			F:    p.invoke.F}
+		op.Invoke, op.Complete, op.OK = p.times(start)
+
+		invoke := fields(p.invoke.Value)
+		ok := fields(p.okValue())
+		switch p.invoke.F {
+		case "send":
+			op.Key, _ = invoke["key"].(string)
+			op.Msg, _ = invoke["msg"].(float64)
+			offset, _ := ok["offset"].(float64)
+			op.Offset = int(offset)
+		case "poll":
+			op.Offsets = offsets(invoke["offsets"])
+			op.Msgs = make(map[string][][]float64)
+			msgs, _ := ok["msgs"].(map[string]any)
+			for key, raw := range msgs {
+				pairs, _ := raw.([]any)
+				for _, pair := range pairs {
+					op.Msgs[key] = append(op.Msgs[key], floats(pair))
+				}
+			}
+		case "commit_offsets":
+			op.Offsets = offsets(invoke["offsets"])
+		case "list_committed_offsets":
+			op.Offsets = offsets(ok["offsets"])
+		default:
+			continue
+		}
+		h.Ops = append(h.Ops, op)
+	}
+	return h
+}
+
+func fields(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
+
+func floats(v any) []float64 {
+	raw, _ := v.([]any)
+	res := make([]float64, 0, len(raw))
+	for _, elem := range raw {
+		if f, ok := elem.(float64); ok {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+func offsets(v any) map[string]int {
+	res := make(map[string]int)
+	for key, raw := range fields(v) {
+		if f, ok := raw.(float64); ok {
+			res[key] = int(f)
+		}
+	}
+	return res
+}
+
+// LoadFiles reads and concatenates the histories in paths, e.g. one per
+// node, or stdin if there are none.
+func LoadFiles(paths []string) ([]Op, error) {
+	if len(paths) == 0 {
+		return Load(os.Stdin)
+	}
+
+	var ops []Op
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		fileOps, err := Load(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		ops = append(ops, fileOps...)
+	}
+	return ops, nil
+}
@@ -0,0 +1,132 @@
+package ids
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"common/clock"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// FormatDense is the format of integers leased in blocks from a KV service.
+// Unlike the other formats it needs a KV, so it's not in Formats and
+// NewGenerator doesn't create it, see NewDense.
+const FormatDense Format = "dense"
+
+// Dense is an integer ID. Dense IDs are unique across the cluster and
+// mostly sequential, each node handing out a contiguous block at a time.
+type Dense int64
+
+func (d Dense) String() string {
+	return strconv.FormatInt(int64(d), 10)
+}
+
+// Info of a dense ID only tells the ID itself, as the counter.
+func (d Dense) Info() Info {
+	return Info{
+		Format:  FormatDense,
+		Node:    -1,
+		Counter: uint64(d)}
+}
+
+func ParseDense(s string) (Dense, error) {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("ids: invalid dense ID %q", s)
+	}
+	return Dense(v), nil
+}
+
+// KV is the part of a KV client used for leasing blocks, e.g. a
+// maelstrom.KV.
+type KV interface {
+	Read(ctx context.Context, key string) (any, error)
+	CompareAndSwap(ctx context.Context, key string, from, to any, createIfNotExists bool) error
+}
+
+// DenseGenerator is a hi/lo allocator: the KV key holds the first ID not
+// leased yet, and a node leases a block by moving it forward with a CAS,
+// then hands the IDs of the block out locally.
+type DenseGenerator struct {
+	kv        KV
+	key       string
+	blockSize int
+	clock     clock.Clock
+	timeout   time.Duration
+	mu        sync.Mutex
+	// [next, end) is what's left of the current block
+	next, end int
+}
+
+// NewDense returns a generator leasing blocks of blockSize IDs through key,
+// with every KV request limited to timeout.
+func NewDense(kv KV, key string, blockSize int, clk clock.Clock, timeout time.Duration) *DenseGenerator {
+	return &DenseGenerator{
+		kv:        kv,
+		key:       key,
+		blockSize: blockSize,
+		clock:     clk,
+		timeout:   timeout}
+}
+
+func (g *DenseGenerator) Next() (Dense, error) {
+	ids, err := g.NextN(1)
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// NextN returns n IDs, leasing a single block big enough for all of them
+// if the current one falls short.
+func (g *DenseGenerator) NextN(n int) ([]Dense, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ids := make([]Dense, 0, n)
+	for len(ids) < n {
+		if g.next == g.end {
+			if err := g.lease(max(g.blockSize, n-len(ids))); err != nil {
+				return nil, err
+			}
+		}
+		ids = append(ids, Dense(g.next))
+		g.next++
+	}
+	return ids, nil
+}
+
+func (g *DenseGenerator) lease(size int) error {
+	for {
+		ctx, cancel := g.clock.WithTimeout(context.Background(), g.timeout)
+		start, err := g.kv.Read(ctx, g.key)
+		cancel()
+		if maelstrom.ErrorCode(err) == maelstrom.KeyDoesNotExist {
+			start, err = 0, nil
+		}
+		if err != nil {
+			return err
+		}
+
+		from, ok := start.(int)
+		if !ok {
+			return fmt.Errorf("ids: %s holds %v, not an integer", g.key, start)
+		}
+
+		ctx, cancel = g.clock.WithTimeout(context.Background(), g.timeout)
+		err = g.kv.CompareAndSwap(ctx, g.key, from, from+size, true)
+		cancel()
+		if err == nil {
+			g.next, g.end = from, from+size
+			return nil
+		}
+		// another node leased the block first
+		if maelstrom.ErrorCode(err) != maelstrom.PreconditionFailed {
+			return err
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Package ids generates unique IDs without coordinating with other nodes.
+//
+// Every format combines a timestamp, the number of the node and a per-node
+// counter, so IDs are unique as long as node numbers are, whatever the
+// random parts turn out to be. The counter keeps the IDs of a node strictly
+// increasing, also when its clock steps back: the timestamp then stays at
+// the last one seen and only the counter moves on.
+package ids
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"common/clock"
+)
+
+// ErrCounterExhausted is returned when more IDs were requested within a
+// single clock tick than the counter can tell apart. It clears once the
+// clock moves past the tick.
+var ErrCounterExhausted = errors.New("ids: counter exhausted")
+
+type Format string
+
+const (
+	FormatUUIDv7     Format = "uuidv7"
+	FormatFastUUIDv7 Format = "uuidv7-fast"
+	FormatSnowflake  Format = "snowflake"
+	FormatULID       Format = "ulid"
+	FormatKSUID      Format = "ksuid"
+)
+
+var Formats = []Format{FormatUUIDv7, FormatFastUUIDv7, FormatSnowflake, FormatULID, FormatKSUID}
+
+type ID interface {
+	String() string
+	Info() Info
+}
+
+// Info is what an ID tells about its origin.
+type Info struct {
+	Format Format
+	// when the ID was generated, zero if the format doesn't tell
+	Time time.Time
+	// number of the node that generated the ID, -1 if the format doesn't
+	// tell
+	Node    int
+	Counter uint64
+	// only set for UUIDs
+	Version int
+	Variant int
+	// why the ID, while decodable, wasn't made by these generators
+	Problem string
+}
+
+type Generator interface {
+	Next() (ID, error)
+	// NextN returns n IDs, in one go if the generator supports it.
+	NextN(n int) ([]ID, error)
+}
+
+// Typed is a generator of IDs of a concrete type.
+type Typed[T ID] interface {
+	Next() (T, error)
+}
+
+// Untyped turns a typed generator into a Generator.
+func Untyped[T ID](g Typed[T]) Generator {
+	return generator[T]{g}
+}
+
+// NewGenerator returns a generator of IDs in the given format for the node
+// with the given number.
+func NewGenerator(format Format, clk clock.Clock, node int) (Generator, error) {
+	switch format {
+	case FormatUUIDv7:
+		return Untyped[UUID](NewUUIDv7(clk, node)), nil
+	case FormatFastUUIDv7:
+		return Untyped[FastUUID](NewFastUUIDv7(clk, node)), nil
+	case FormatSnowflake:
+		g, err := NewSnowflake(clk, node)
+		if err != nil {
+			return nil, err
+		}
+		return Untyped[Snowflake](g), nil
+	case FormatULID:
+		return Untyped[ULID](NewULID(clk, node)), nil
+	case FormatKSUID:
+		return Untyped[KSUID](NewKSUID(clk, node)), nil
+	default:
+		return nil, fmt.Errorf("ids: unknown format %q", format)
+	}
+}
+
+type generator[T ID] struct {
+	g Typed[T]
+}
+
+func (g generator[T]) Next() (ID, error) {
+	id, err := g.g.Next()
+	if err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func (g generator[T]) NextN(n int) ([]ID, error) {
+	ids := make([]ID, 0, n)
+	if batch, ok := g.g.(interface{ NextN(int) ([]T, error) }); ok {
+		typed, err := batch.NextN(n)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range typed {
+			ids = append(ids, id)
+		}
+		return ids, nil
+	}
+
+	for range n {
+		id, err := g.g.Next()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Parse parses and validates an ID in the given format.
+func Parse(format Format, s string) (ID, error) {
+	switch format {
+	case FormatUUIDv7:
+		return ParseUUIDv7(s)
+	case FormatFastUUIDv7:
+		return ParseFastUUIDv7(s)
+	case FormatSnowflake:
+		return ParseSnowflake(s)
+	case FormatULID:
+		return ParseULID(s)
+	case FormatKSUID:
+		return ParseKSUID(s)
+	case FormatDense:
+		return ParseDense(s)
+	default:
+		return nil, fmt.Errorf("ids: unknown format %q", format)
+	}
+}
+
+// Detect guesses the format of s from its length and characters. Dense IDs
+// look like Snowflakes and the UUIDs of FastUUIDv7 like the ones of
+// UUIDv7, so they're never guessed.
+func Detect(s string) (Format, error) {
+	switch {
+	case len(s) == 36 && strings.Count(s, "-") == 4:
+		return FormatUUIDv7, nil
+	case len(s) == 26:
+		return FormatULID, nil
+	case len(s) == 27:
+		return FormatKSUID, nil
+	case s != "" && strings.Trim(s, "0123456789") == "":
+		return FormatSnowflake, nil
+	default:
+		return "", fmt.Errorf("ids: unknown format of %q", s)
+	}
+}
+
+// Inspect decodes s in the given format, guessed if empty. A string that
+// can't be an ID of the format at all is an error, one that can but doesn't
+// follow these generators, e.g. a UUID of another version, has the Problem
+// of its Info set.
+func Inspect(format Format, s string) (Info, error) {
+	if format == "" {
+		var err error
+		if format, err = Detect(s); err != nil {
+			return Info{}, err
+		}
+	}
+
+	if format == FormatUUIDv7 || format == FormatFastUUIDv7 {
+		u, err := parseUUID(s)
+		if err != nil {
+			return Info{}, err
+		}
+		if err := u.check(); err != nil {
+			// the rest of the layout is only known for version 7
+			return Info{
+				Format:  format,
+				Node:    -1,
+				Version: u.Version(),
+				Variant: u.Variant(),
+				Problem: err.Error()}, nil
+		}
+	}
+
+	id, err := Parse(format, s)
+	if err != nil {
+		return Info{}, err
+	}
+	return id.Info(), nil
+}
+
+// NodeNumber returns the number of a Maelstrom node ID, e.g. 3 for "n3".
+func NodeNumber(nodeID string) (int, error) {
+	num, ok := strings.CutPrefix(nodeID, "n")
+	if !ok {
+		return 0, fmt.Errorf("ids: not a node ID: %q", nodeID)
+	}
+	node, err := strconv.Atoi(num)
+	if err != nil || node < 0 {
+		return 0, fmt.Errorf("ids: not a node ID: %q", nodeID)
+	}
+	return node, nil
+}
+
+// sequence hands out (tick, counter) pairs increasing in that order.
+type sequence struct {
+	mu      sync.Mutex
+	last    int64
+	counter uint64
+	// counter values are below 1<<bits
+	bits uint
+	// new ticks start the counter at a random value below 1<<seedBits,
+	// or at 0 if seedBits is 0
+	seedBits uint
+}
+
+func (s *sequence) next(tick int64) (int64, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tick > s.last {
+		s.last = tick
+		s.counter = 0
+		if s.seedBits > 0 {
+			s.counter = rand.Uint64() >> (64 - s.seedBits)
+		}
+	} else if s.counter == ^uint64(0)>>(64-s.bits) {
+		return 0, 0, ErrCounterExhausted
+	} else {
+		s.counter++
+	}
+	return s.last, s.counter, nil
+}
@@ -0,0 +1,268 @@
+package ids
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"common/clock"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// memKV is an in-memory stand-in for lin-kv, shared by the nodes of a test.
+type memKV struct {
+	mu     sync.Mutex
+	values map[string]any
+}
+
+func newMemKV() *memKV {
+	return &memKV{values: make(map[string]any)}
+}
+
+func (kv *memKV) Read(ctx context.Context, key string) (any, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	v, ok := kv.values[key]
+	if !ok {
+		return nil, maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "key does not exist")
+	}
+	return v, nil
+}
+
+func (kv *memKV) CompareAndSwap(ctx context.Context, key string, from, to any, createIfNotExists bool) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	v, ok := kv.values[key]
+	switch {
+	case !ok && !createIfNotExists:
+		return maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "key does not exist")
+	case ok && v != from:
+		return maelstrom.NewRPCError(maelstrom.PreconditionFailed, fmt.Sprintf("expected %v, got %v", from, v))
+	}
+	kv.values[key] = to
+	return nil
+}
+
+// generators returns a new generator of every format for the node with
+// the given number, the dense ones sharing kv.
+func generators(t testing.TB, kv KV, node int) map[string]Generator {
+	clk := clock.Real()
+	gens := make(map[string]Generator)
+	for _, format := range Formats {
+		g, err := NewGenerator(format, clk, node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gens[string(format)] = g
+	}
+	gens[string(FormatDense)] = Untyped[Dense](NewDense(kv, "ids", 100, clk, time.Second))
+	return gens
+}
+
+func TestUnique(t *testing.T) {
+	const nodes, goroutines = 4, 8
+	perGoroutine := 20000
+	if testing.Short() {
+		perGoroutine = 2000
+	}
+
+	kv := newMemKV()
+	// format -> generator of each node
+	byFormat := make(map[string][]Generator)
+	for node := range nodes {
+		for format, g := range generators(t, kv, node) {
+			byFormat[format] = append(byFormat[format], g)
+		}
+	}
+
+	for format, gens := range byFormat {
+		t.Run(format, func(t *testing.T) {
+			t.Parallel()
+
+			results := make([][]string, nodes*goroutines)
+			var wg sync.WaitGroup
+			for i := range results {
+				g := gens[i%nodes]
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range perGoroutine {
+						id, err := g.Next()
+						// a tick ran out of counter values, wait for the next
+						for err == ErrCounterExhausted {
+							runtime.Gosched()
+							id, err = g.Next()
+						}
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						results[i] = append(results[i], id.String())
+					}
+				}()
+			}
+			wg.Wait()
+
+			seen := make(map[string]bool, nodes*goroutines*perGoroutine)
+			for _, ids := range results {
+				for _, id := range ids {
+					if seen[id] {
+						t.Fatalf("duplicate ID %s", id)
+					}
+					seen[id] = true
+				}
+			}
+		})
+	}
+}
+
+// TestFastUnique generates tens of millions of IDs with FastUUIDv7 from
+// many goroutines of several nodes. What sets them apart, apart from the
+// random bits, fits into 64 bits, which are checked for duplicates.
+func TestFastUnique(t *testing.T) {
+	const nodes, goroutines = 4, 8
+	perGoroutine := 1_000_000
+	if testing.Short() {
+		perGoroutine = 20000
+	}
+
+	start := time.Now().UnixMilli()
+	keys := make([]uint64, nodes*goroutines*perGoroutine)
+	var gens []*FastUUIDv7
+	for node := range nodes {
+		gens = append(gens, NewFastUUIDv7(clock.Real(), node))
+	}
+	var wg sync.WaitGroup
+	for i := range nodes * goroutines {
+		g := gens[i%nodes]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range perGoroutine {
+				u, err := g.Next()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				info := u.Info()
+				shard := uint64(u[11]&0x0f)<<4 | uint64(u[12]>>4)
+				ms := uint64(info.Time.UnixMilli() - start)
+				keys[i*perGoroutine+j] = ms<<34 | info.Counter<<12 | uint64(info.Node)<<8 | shard
+			}
+		}()
+	}
+	wg.Wait()
+
+	slices.Sort(keys)
+	for i := 1; i < len(keys); i++ {
+		if keys[i] == keys[i-1] {
+			t.Fatalf("duplicate ID, key %#x", keys[i])
+		}
+	}
+}
+
+func TestFastUUIDv7Info(t *testing.T) {
+	now := time.UnixMilli(1700000000123)
+	g := NewFastUUIDv7(clock.NewFake(now), 1234)
+	for counter := range uint64(3) {
+		u, err := g.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := Inspect(FormatFastUUIDv7, u.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Format != FormatFastUUIDv7 || !info.Time.Equal(now) || info.Node != 1234 ||
+			info.Version != 7 || info.Variant != 0b10 || info.Problem != "" ||
+			// each shard counts on its own
+			info.Counter > counter {
+			t.Errorf("%s decodes to %+v", u, info)
+		}
+	}
+}
+
+func benchmark(b *testing.B, g Generator) {
+	for b.Loop() {
+		if _, err := g.Next(); err != nil && err != ErrCounterExhausted {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkString(b *testing.B, g Generator) {
+	for b.Loop() {
+		id, err := g.Next()
+		if err == nil {
+			_ = id.String()
+		}
+	}
+}
+
+func benchmarkParallel(b *testing.B, g Generator) {
+	b.SetParallelism(4)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			g.Next()
+		}
+	})
+}
+
+// BenchmarkSprintf is how IDs used to be generated, for comparison.
+func BenchmarkSprintf(b *testing.B) {
+	for b.Loop() {
+		now := time.Now().UnixMilli()
+		rand1 := 0x7<<12 + rand.IntN(1<<12)
+		rand2 := 0b10<<14 + rand.IntN(1<<14)
+		rand3 := rand.IntN(1 << 48)
+		_ = fmt.Sprintf("%08x-%04x-%04x-%04x-%012x", now>>16, now&0xffff, rand1, rand2, rand3)
+	}
+}
+
+func BenchmarkUUIDv7(b *testing.B) {
+	benchmark(b, generators(b, newMemKV(), 1)[string(FormatUUIDv7)])
+}
+
+func BenchmarkUUIDv7String(b *testing.B) {
+	benchmarkString(b, generators(b, newMemKV(), 1)[string(FormatUUIDv7)])
+}
+
+func BenchmarkUUIDv7Parallel(b *testing.B) {
+	benchmarkParallel(b, generators(b, newMemKV(), 1)[string(FormatUUIDv7)])
+}
+
+func BenchmarkFastUUIDv7(b *testing.B) {
+	benchmark(b, generators(b, newMemKV(), 1)[string(FormatFastUUIDv7)])
+}
+
+func BenchmarkFastUUIDv7String(b *testing.B) {
+	benchmarkString(b, generators(b, newMemKV(), 1)[string(FormatFastUUIDv7)])
+}
+
+func BenchmarkFastUUIDv7Parallel(b *testing.B) {
+	benchmarkParallel(b, generators(b, newMemKV(), 1)[string(FormatFastUUIDv7)])
+}
+
+func BenchmarkSnowflake(b *testing.B) {
+	benchmark(b, generators(b, newMemKV(), 1)[string(FormatSnowflake)])
+}
+
+func BenchmarkULID(b *testing.B) {
+	benchmark(b, generators(b, newMemKV(), 1)[string(FormatULID)])
+}
+
+func BenchmarkKSUID(b *testing.B) {
+	benchmark(b, generators(b, newMemKV(), 1)[string(FormatKSUID)])
+}
+
+func BenchmarkDense(b *testing.B) {
+	benchmark(b, generators(b, newMemKV(), 1)[string(FormatDense)])
+}
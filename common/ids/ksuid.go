@@ -0,0 +1,101 @@
+package ids
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"common/clock"
+)
+
+// KSUIDEpoch is the start of KSUID timestamps, in Unix seconds.
+const KSUIDEpoch = 1400000000
+
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// KSUID is a 160-bit ID of 32 bits of seconds since KSUIDEpoch followed by
+// a 128-bit payload that here is a 16-bit node number, a 48-bit counter and
+// 64 random bits. Its textual form is 27 characters of base62.
+type KSUID [20]byte
+
+func (k KSUID) String() string {
+	v := new(big.Int).SetBytes(k[:])
+	buf := []byte(v.Text(62))
+	// big.Int uses 0-9a-zA-Z, KSUIDs 0-9A-Za-z
+	for i, c := range buf {
+		switch {
+		case c >= 'a' && c <= 'z':
+			buf[i] = c - 'a' + 'A'
+		case c >= 'A' && c <= 'Z':
+			buf[i] = c - 'A' + 'a'
+		}
+	}
+	return strings.Repeat("0", 27-len(buf)) + string(buf)
+}
+
+func (k KSUID) Info() Info {
+	payload := binary.BigEndian.Uint64(k[4:12])
+	return Info{
+		Format:  FormatKSUID,
+		Time:    time.Unix(int64(binary.BigEndian.Uint32(k[:4]))+KSUIDEpoch, 0),
+		Node:    int(payload >> ksuidCounterBits),
+		Counter: payload & (1<<ksuidCounterBits - 1)}
+}
+
+func ParseKSUID(s string) (KSUID, error) {
+	if len(s) != 27 {
+		return KSUID{}, fmt.Errorf("ids: invalid KSUID %q", s)
+	}
+
+	v := new(big.Int)
+	base := big.NewInt(62)
+	for _, c := range s {
+		digit := strings.IndexRune(base62, c)
+		if digit < 0 {
+			return KSUID{}, fmt.Errorf("ids: invalid KSUID %q", s)
+		}
+		v.Mul(v, base).Add(v, big.NewInt(int64(digit)))
+	}
+	if v.BitLen() > 160 {
+		return KSUID{}, fmt.Errorf("ids: KSUID %q out of range", s)
+	}
+
+	var k KSUID
+	v.FillBytes(k[:])
+	return k, nil
+}
+
+const ksuidCounterBits = 48
+
+type KSUIDGenerator struct {
+	clock clock.Clock
+	node  uint16
+	seq   sequence
+}
+
+func NewKSUID(clk clock.Clock, node int) *KSUIDGenerator {
+	return &KSUIDGenerator{
+		clock: clk,
+		node:  uint16(node),
+		seq:   sequence{bits: ksuidCounterBits, seedBits: ksuidCounterBits - 1}}
+}
+
+func (g *KSUIDGenerator) Next() (KSUID, error) {
+	tick := g.clock.Now().Unix() - KSUIDEpoch
+	tick, counter, err := g.seq.next(tick)
+	if err != nil {
+		return KSUID{}, err
+	}
+	if tick < 0 || tick >= 1<<32 {
+		return KSUID{}, fmt.Errorf("ids: time out of the KSUID range")
+	}
+
+	var k KSUID
+	binary.BigEndian.PutUint32(k[:4], uint32(tick))
+	binary.BigEndian.PutUint64(k[4:12], uint64(g.node)<<ksuidCounterBits|counter)
+	binary.BigEndian.PutUint64(k[12:], rand.Uint64())
+	return k, nil
+}
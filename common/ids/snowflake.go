@@ -0,0 +1,77 @@
+package ids
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"common/clock"
+)
+
+// SnowflakeEpoch is the start of Snowflake timestamps, the one of Twitter's.
+var SnowflakeEpoch = time.UnixMilli(1288834974657)
+
+const (
+	snowflakeTimeBits = 41
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+)
+
+// Snowflake is a 64-bit ID made of a zero sign bit, 41 bits of
+// milliseconds since SnowflakeEpoch, a 10-bit node number and a 12-bit
+// sequence. Its textual form is the decimal number, since JSON numbers
+// that big lose precision in many decoders.
+type Snowflake uint64
+
+func (s Snowflake) String() string {
+	return strconv.FormatUint(uint64(s), 10)
+}
+
+func (s Snowflake) Info() Info {
+	return Info{
+		Format:  FormatSnowflake,
+		Time:    SnowflakeEpoch.Add(time.Duration(s>>(snowflakeNodeBits+snowflakeSeqBits)) * time.Millisecond),
+		Node:    int(s >> snowflakeSeqBits & (1<<snowflakeNodeBits - 1)),
+		Counter: uint64(s & (1<<snowflakeSeqBits - 1))}
+}
+
+func ParseSnowflake(s string) (Snowflake, error) {
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ids: invalid Snowflake %q", s)
+	}
+	if v>>63 != 0 {
+		return 0, fmt.Errorf("ids: Snowflake %q has the sign bit set", s)
+	}
+	return Snowflake(v), nil
+}
+
+type SnowflakeGenerator struct {
+	clock clock.Clock
+	node  uint64
+	seq   sequence
+}
+
+// NewSnowflake returns a Snowflake generator, node has to fit in 10 bits.
+func NewSnowflake(clk clock.Clock, node int) (*SnowflakeGenerator, error) {
+	if node < 0 || node >= 1<<snowflakeNodeBits {
+		return nil, fmt.Errorf("ids: node %d doesn't fit in a Snowflake", node)
+	}
+	return &SnowflakeGenerator{
+		clock: clk,
+		node:  uint64(node),
+		seq:   sequence{bits: snowflakeSeqBits}}, nil
+}
+
+func (g *SnowflakeGenerator) Next() (Snowflake, error) {
+	tick := g.clock.Now().Sub(SnowflakeEpoch).Milliseconds()
+	tick, seq, err := g.seq.next(tick)
+	if err != nil {
+		return 0, err
+	}
+	if tick < 0 || tick >= 1<<snowflakeTimeBits {
+		return 0, fmt.Errorf("ids: time out of the Snowflake range")
+	}
+
+	return Snowflake(uint64(tick)<<(snowflakeNodeBits+snowflakeSeqBits) | g.node<<snowflakeSeqBits | seq), nil
+}
@@ -0,0 +1,92 @@
+package ids
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"common/clock"
+)
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID is a 128-bit ID of 48 bits of milliseconds followed by 80 bits that
+// here are a 16-bit node number and a 64-bit counter. Its textual form is
+// 26 characters of Crockford base32.
+type ULID [16]byte
+
+func (u ULID) String() string {
+	hi := binary.BigEndian.Uint64(u[:8])
+	lo := binary.BigEndian.Uint64(u[8:])
+
+	// 26 characters of 5 bits cover 130 bits, the first one only 3
+	buf := make([]byte, 26)
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf)
+}
+
+func (u ULID) Info() Info {
+	hi := binary.BigEndian.Uint64(u[:8])
+	return Info{
+		Format:  FormatULID,
+		Time:    time.UnixMilli(int64(hi >> 16)),
+		Node:    int(hi & 0xffff),
+		Counter: binary.BigEndian.Uint64(u[8:])}
+}
+
+func ParseULID(s string) (ULID, error) {
+	if len(s) != 26 {
+		return ULID{}, fmt.Errorf("ids: invalid ULID %q", s)
+	}
+
+	var hi, lo uint64
+	for i, c := range strings.ToUpper(s) {
+		v := strings.IndexRune(crockford, c)
+		switch c {
+		case 'I', 'L':
+			v = 1
+		case 'O':
+			v = 0
+		}
+		if v < 0 || (i == 0 && v > 7) {
+			return ULID{}, fmt.Errorf("ids: invalid ULID %q", s)
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+
+	var u ULID
+	binary.BigEndian.PutUint64(u[:8], hi)
+	binary.BigEndian.PutUint64(u[8:], lo)
+	return u, nil
+}
+
+type ULIDGenerator struct {
+	clock clock.Clock
+	node  uint16
+	seq   sequence
+}
+
+func NewULID(clk clock.Clock, node int) *ULIDGenerator {
+	return &ULIDGenerator{
+		clock: clk,
+		node:  uint16(node),
+		seq:   sequence{bits: 64, seedBits: 63}}
+}
+
+func (g *ULIDGenerator) Next() (ULID, error) {
+	tick, counter, err := g.seq.next(g.clock.Now().UnixMilli())
+	if err != nil {
+		return ULID{}, err
+	}
+
+	var u ULID
+	binary.BigEndian.PutUint64(u[:8], uint64(tick)<<16|uint64(g.node))
+	binary.BigEndian.PutUint64(u[8:], counter)
+	return u, nil
+}
@@ -0,0 +1,153 @@
+package ids
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"common/clock"
+)
+
+// UUID is an RFC 9562 UUID.
+type UUID [16]byte
+
+func (u UUID) String() string {
+	var arr [36]byte
+	buf := arr[:]
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf)
+}
+
+// ParseUUIDv7 parses the canonical textual form of a version 7 UUID.
+func ParseUUIDv7(s string) (UUID, error) {
+	u, err := parseUUID(s)
+	if err != nil {
+		return UUID{}, err
+	}
+	if err := u.check(); err != nil {
+		return UUID{}, err
+	}
+	return u, nil
+}
+
+// parseUUID parses the canonical textual form of a UUID of any version.
+func parseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return UUID{}, fmt.Errorf("ids: invalid UUID %q", s)
+	}
+	hexStr := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	if _, err := hex.Decode(u[:], []byte(hexStr)); err != nil {
+		return UUID{}, fmt.Errorf("ids: invalid UUID %q", s)
+	}
+	return u, nil
+}
+
+// check reports whether u is a version 7 UUID of the RFC 9562 variant.
+func (u UUID) check() error {
+	if u.Version() != 7 {
+		return fmt.Errorf("ids: UUID %s is version %d, not 7", u, u.Version())
+	}
+	if u.Variant() != 0b10 {
+		return fmt.Errorf("ids: UUID %s is not of the RFC 9562 variant", u)
+	}
+	return nil
+}
+
+func (u UUID) Version() int {
+	return int(u[6] >> 4)
+}
+
+// Variant returns the variant bits, 0b10 for RFC 9562 UUIDs. The ones of
+// other variants are returned as they are, e.g. 0b110 for Microsoft GUIDs.
+func (u UUID) Variant() int {
+	switch {
+	case u[8]>>7 == 0:
+		return 0
+	case u[8]>>6 == 0b10:
+		return 0b10
+	default:
+		return int(u[8] >> 5)
+	}
+}
+
+// Info decodes u as laid out by UUIDv7.
+func (u UUID) Info() Info {
+	ms := int64(u[0])<<40 | int64(u[1])<<32 | int64(u[2])<<24 | int64(u[3])<<16 | int64(u[4])<<8 | int64(u[5])
+	subMs := int64(u[6]&0x0f)<<8 | int64(u[7])
+	return Info{
+		Format:  FormatUUIDv7,
+		Time:    time.UnixMilli(ms).Add(time.Duration(subMs * 1e6 >> uuidSubMsBits)),
+		Node:    int(u[12])<<8 | int(u[13]),
+		Counter: uint64(u[8]&0x3f)<<24 | uint64(u[9])<<16 | uint64(u[10])<<8 | uint64(u[11]),
+		Version: u.Version(),
+		Variant: u.Variant()}
+}
+
+const (
+	// rand_a holds the fraction of the millisecond (RFC 9562 method 3)
+	uuidSubMsBits = 12
+	// the leftmost bits of rand_b hold the counter (method 1), followed
+	// by the node number and random bits
+	uuidCounterBits = 30
+)
+
+// UUIDv7 generates version 7 UUIDs laid out as 48 bits of milliseconds,
+// 12 bits of the fraction of the millisecond, a 30-bit counter, a 16-bit
+// node number and 16 random bits.
+type UUIDv7 struct {
+	clock clock.Clock
+	node  uint16
+	seq   sequence
+}
+
+func NewUUIDv7(clk clock.Clock, node int) *UUIDv7 {
+	return &UUIDv7{
+		clock: clk,
+		node:  uint16(node),
+		// counters start below half of their range, so a tick fits at
+		// least 2^29 IDs
+		seq: sequence{bits: uuidCounterBits, seedBits: uuidCounterBits - 1}}
+}
+
+func (g *UUIDv7) Next() (UUID, error) {
+	now := g.clock.Now()
+	tick := now.UnixMilli()<<uuidSubMsBits | int64(now.Nanosecond()%1e6)<<uuidSubMsBits/1e6
+
+	tick, counter, err := g.seq.next(tick)
+	if err != nil {
+		return UUID{}, err
+	}
+
+	var u UUID
+	ms := tick >> uuidSubMsBits
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+	// version, rand_a
+	u[6] = 0x70 | byte(tick>>8)&0x0f
+	u[7] = byte(tick)
+	// variant, counter
+	u[8] = 0x80 | byte(counter>>24)&0x3f
+	u[9] = byte(counter >> 16)
+	u[10] = byte(counter >> 8)
+	u[11] = byte(counter)
+	u[12] = byte(g.node >> 8)
+	u[13] = byte(g.node)
+	random := rand.Uint32()
+	u[14] = byte(random >> 8)
+	u[15] = byte(random)
+	return u, nil
+}
@@ -0,0 +1,191 @@
+// Package kvstore implements local stand-ins for Maelstrom's seq-kv, lin-kv
+// and lww-kv services, which can be attached to a simulated network.
+package kvstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"sync"
+
+	"common/sim"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// Store answers read, write and cas requests. Every write creates a new
+// version of the store, the history of each key is kept so that seq-kv
+// can serve reads from an older version.
+type Store struct {
+	node    *maelstrom.Node
+	typ     string
+	mu      sync.Mutex
+	version int
+	history map[string][]entry
+	// client -> latest version it has observed
+	views map[string]int
+	// probability of a read not moving the client's view forward
+	staleness float64
+	rng       *rand.Rand
+}
+
+type entry struct {
+	version int
+	value   any
+}
+
+type readBody struct {
+	Key string `json:"key"`
+}
+
+type writeBody struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+type casBody struct {
+	Key               string `json:"key"`
+	From              any    `json:"from"`
+	To                any    `json:"to"`
+	CreateIfNotExists bool   `json:"create_if_not_exists"`
+}
+
+// NewLinKV returns a linearizable store, every operation sees the latest
+// version.
+func NewLinKV() *Store {
+	return newStore(maelstrom.LinKV, 0, 0)
+}
+
+// NewSeqKV returns a sequentially consistent store. With the given
+// probability a read returns the version the client has last observed
+// instead of the latest one, i.e. a stale but sequential value. Only the
+// client's own writes and CASes are guaranteed to move its view forward.
+func NewSeqKV(staleness float64, seed uint64) *Store {
+	return newStore(maelstrom.SeqKV, staleness, seed)
+}
+
+// NewLWWKV returns a last-write-wins store. With the given probability a
+// read returns any earlier version of the key, also one older than what
+// the client has already seen, or no value at all.
+func NewLWWKV(staleness float64, seed uint64) *Store {
+	return newStore(maelstrom.LWWKV, staleness, seed)
+}
+
+func newStore(typ string, staleness float64, seed uint64) *Store {
+	s := &Store{
+		node:      maelstrom.NewNode(),
+		typ:       typ,
+		history:   make(map[string][]entry),
+		views:     make(map[string]int),
+		staleness: staleness,
+		rng:       rand.New(rand.NewPCG(seed, seed))}
+
+	s.node.Handle("read", s.handleRead)
+	s.node.Handle("write", s.handleWrite)
+	s.node.Handle("cas", s.handleCAS)
+
+	return s
+}
+
+// ID returns the service name the store answers to, e.g. "lin-kv".
+func (s *Store) ID() string {
+	return s.typ
+}
+
+// Node returns the node serving the store, for hosting it elsewhere.
+func (s *Store) Node() *maelstrom.Node {
+	return s.node
+}
+
+// Attach connects the store to a simulated network under its service name.
+func (s *Store) Attach(nw *sim.Network) {
+	nw.AddService(s.typ, s.node)
+}
+
+func (s *Store) handleRead(msg maelstrom.Message) error {
+	var body readBody
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
+	}
+
+	s.mu.Lock()
+	version := s.version
+	if s.staleness > 0 && s.rng.Float64() < s.staleness {
+		if s.typ == maelstrom.LWWKV {
+			version = s.rng.IntN(s.version + 1)
+		} else {
+			version = s.views[msg.Src]
+		}
+	}
+	s.views[msg.Src] = version
+	value, ok := s.valueAt(body.Key, version)
+	s.mu.Unlock()
+
+	if !ok {
+		return maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "key does not exist")
+	}
+
+	replyBody := map[string]any{
+		"type":  "read_ok",
+		"value": value}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *Store) handleWrite(msg maelstrom.Message) error {
+	var body writeBody
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
+	}
+
+	s.mu.Lock()
+	s.put(msg.Src, body.Key, body.Value)
+	s.mu.Unlock()
+
+	replyBody := map[string]any{
+		"type": "write_ok"}
+	return s.node.Reply(msg, replyBody)
+}
+
+func (s *Store) handleCAS(msg maelstrom.Message) error {
+	var body casBody
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return maelstrom.NewRPCError(maelstrom.MalformedRequest, err.Error())
+	}
+
+	s.mu.Lock()
+	current, ok := s.valueAt(body.Key, s.version)
+	switch {
+	case !ok && !body.CreateIfNotExists:
+		s.mu.Unlock()
+		return maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "key does not exist")
+	case ok && !reflect.DeepEqual(current, body.From):
+		s.mu.Unlock()
+		text := fmt.Sprintf("expected %v, but had %v", body.From, current)
+		return maelstrom.NewRPCError(maelstrom.PreconditionFailed, text)
+	}
+	s.put(msg.Src, body.Key, body.To)
+	s.mu.Unlock()
+
+	replyBody := map[string]any{
+		"type": "cas_ok"}
+	return s.node.Reply(msg, replyBody)
+}
+
+// put has to be called with mu held.
+func (s *Store) put(src, key string, value any) {
+	s.version++
+	s.history[key] = append(s.history[key], entry{version: s.version, value: value})
+	s.views[src] = s.version
+}
+
+// valueAt has to be called with mu held.
+func (s *Store) valueAt(key string, version int) (any, bool) {
+	entries := s.history[key]
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].version <= version {
+			return entries[i].value, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,85 @@
+//go:build go1.25
+
+package kvstore
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"common/sim"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func call(t *testing.T, c *sim.Client, body map[string]any) (maelstrom.Message, error) {
+	t.Helper()
+	return c.Call(maelstrom.SeqKV, body, time.Second)
+}
+
+// readCounter reads "counter" the way the counter of challenge #4 does,
+// writing the client's own key first if ownKey is set.
+func readCounter(t *testing.T, c *sim.Client, ownKey bool) (float64, error) {
+	t.Helper()
+	if ownKey {
+		if _, err := call(t, c, map[string]any{"type": "write", "key": c.ID(), "value": 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := call(t, c, map[string]any{"type": "read", "key": "counter"})
+	if err != nil {
+		return 0, err
+	}
+	var body struct {
+		Value float64 `json:"value"`
+	}
+	if err := json.Unmarshal(res.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Value, nil
+}
+
+// TestSeqKVOwnKey shows why the counter writes its own key before reading
+// "counter": seq-kv may serve a read from the version the client saw last,
+// from before another client's CAS, and only the client's own writes are
+// sure to move it forward.
+func TestSeqKVOwnKey(t *testing.T) {
+	for _, ownKey := range []bool{false, true} {
+		synctest.Test(t, func(t *testing.T) {
+			nw := sim.New(sim.Config{
+				Seed:    1,
+				Latency: sim.Latency{Base: time.Millisecond},
+				Wait:    synctest.Wait})
+			// every read that may be stale is
+			NewSeqKV(1, 1).Attach(nw)
+			adder, reader := nw.Client(), nw.Client()
+
+			_, err := call(t, adder, map[string]any{
+				"type": "cas", "key": "counter", "from": 0, "to": 5, "create_if_not_exists": true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			value, err := readCounter(t, reader, ownKey)
+			switch {
+			case !ownKey && maelstrom.ErrorCode(err) != maelstrom.KeyDoesNotExist:
+				t.Errorf("read without writing the own key first got %v, %v, want a stale key does not exist", value, err)
+			case ownKey && (err != nil || value != 5):
+				t.Errorf("read after writing the own key got %v, %v, want 5", value, err)
+			}
+
+			nw.Drain()
+			nw.Close()
+		})
+	}
+}
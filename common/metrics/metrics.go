@@ -0,0 +1,162 @@
+// Package metrics keeps per-node counters: traffic by message type and
+// peer, RPC timeouts, CAS failures, retries and sizes of local queues and
+// caches. They're served through the "metrics" RPC and dumped to stderr
+// on shutdown (see package shutdown).
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"common/wire"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// Names of the counters incremented by the challenges.
+const (
+	SyncRPCTimeouts = "syncrpc_timeouts"
+	CASFailures     = "cas_failures"
+	Retries         = "retries"
+)
+
+type Registry struct {
+	node *maelstrom.Node
+	mu   sync.Mutex
+	// type -> peer -> count
+	sent     map[string]map[string]int
+	received map[string]map[string]int
+	counters map[string]int
+	gauges   map[string]func() int
+}
+
+type Snapshot struct {
+	Sent     map[string]map[string]int `json:"sent"`
+	Received map[string]map[string]int `json:"received"`
+	Counters map[string]int            `json:"counters"`
+	Gauges   map[string]int            `json:"gauges"`
+}
+
+type metricsOK struct {
+	Type    string   `json:"type"`
+	Metrics Snapshot `json:"metrics"`
+}
+
+// New starts counting the traffic of n, which must not be running yet.
+func New(n *maelstrom.Node) *Registry {
+	r := &Registry{
+		node:     n,
+		sent:     make(map[string]map[string]int),
+		received: make(map[string]map[string]int),
+		counters: make(map[string]int),
+		gauges:   make(map[string]func() int)}
+
+	wire.OnReceive(n, func(msg maelstrom.Message) {
+		r.count(r.received, msg.Type(), msg.Src)
+	})
+	wire.OnSend(n, func(msg maelstrom.Message) {
+		r.count(r.sent, msg.Type(), msg.Dest)
+	})
+
+	return r
+}
+
+func (r *Registry) count(traffic map[string]map[string]int, typ, peer string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byPeer, ok := traffic[typ]
+	if !ok {
+		byPeer = make(map[string]int)
+		traffic[typ] = byPeer
+	}
+	byPeer[peer]++
+}
+
+// Inc increments the named counter.
+func (r *Registry) Inc(name string) {
+	r.mu.Lock()
+	r.counters[name]++
+	r.mu.Unlock()
+}
+
+// RPCError counts err as a SyncRPC timeout if it is one. Returns err.
+func (r *Registry) RPCError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		r.Inc(SyncRPCTimeouts)
+	}
+	return err
+}
+
+// CASError counts err as a CAS failure if the KV service refused the
+// compare-and-set because the value didn't match. Returns err.
+func (r *Registry) CASError(err error) error {
+	if maelstrom.ErrorCode(err) == maelstrom.PreconditionFailed {
+		r.Inc(CASFailures)
+	}
+	return err
+}
+
+// Gauge registers fn to be called for the current value of the named gauge.
+func (r *Registry) Gauge(name string, fn func() int) {
+	r.mu.Lock()
+	r.gauges[name] = fn
+	r.mu.Unlock()
+}
+
+func (r *Registry) Snapshot() Snapshot {
+	r.mu.Lock()
+	s := Snapshot{
+		Sent:     copyTraffic(r.sent),
+		Received: copyTraffic(r.received),
+		Counters: make(map[string]int, len(r.counters)),
+		Gauges:   make(map[string]int, len(r.gauges))}
+	for name, value := range r.counters {
+		s.Counters[name] = value
+	}
+	gauges := make(map[string]func() int, len(r.gauges))
+	for name, fn := range r.gauges {
+		gauges[name] = fn
+	}
+	r.mu.Unlock()
+
+	// gauges take their own locks
+	for name, fn := range gauges {
+		s.Gauges[name] = fn()
+	}
+	return s
+}
+
+func copyTraffic(traffic map[string]map[string]int) map[string]map[string]int {
+	c := make(map[string]map[string]int, len(traffic))
+	for typ, byPeer := range traffic {
+		c[typ] = make(map[string]int, len(byPeer))
+		for peer, count := range byPeer {
+			c[typ][peer] = count
+		}
+	}
+	return c
+}
+
+// Handle answers the "metrics" RPC with a snapshot of all the counters.
+func (r *Registry) Handle(msg maelstrom.Message) error {
+	replyBody := metricsOK{
+		Type:    "metrics_ok",
+		Metrics: r.Snapshot()}
+	return r.node.Reply(msg, replyBody)
+}
+
+// Dump writes the snapshot to stderr as JSON.
+func (r *Registry) Dump() {
+	buf, err := json.Marshal(r.Snapshot())
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	fmt.Fprintf(os.Stderr, "metrics %s\n", buf)
+}
@@ -0,0 +1,100 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"common/wire"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// TestTraffic runs a node over pipes and checks that the snapshot counts
+// what it read and wrote.
+func TestTraffic(t *testing.T) {
+	n := maelstrom.NewNode()
+	n.Init("n0", []string{"n0", "n1"})
+	inR, inW := io.Pipe()
+	n.Stdin = inR
+	n.Stdout = io.Discard
+	r := New(n)
+	// tapped after the registry, so a reply is only seen once counted
+	replies := make(chan maelstrom.Message, 1)
+	wire.OnSend(n, func(msg maelstrom.Message) { replies <- msg })
+
+	n.Handle("metrics", r.Handle)
+	n.Handle("echo", func(msg maelstrom.Message) error {
+		return n.Reply(msg, maelstrom.MessageBody{
+			Type: "echo_ok"})
+	})
+	n.Handle("cas", func(msg maelstrom.Message) error {
+		r.CASError(maelstrom.NewRPCError(maelstrom.PreconditionFailed, "mismatch"))
+		r.CASError(maelstrom.NewRPCError(maelstrom.KeyDoesNotExist, "missing"))
+		r.RPCError(context.DeadlineExceeded)
+		return n.Reply(msg, maelstrom.MessageBody{
+			Type: "cas_ok"})
+	})
+	r.Gauge("queue", func() int { return 3 })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n.Run()
+	}()
+	defer func() {
+		inW.Close()
+		<-done
+	}()
+
+	msgID := 0
+	request := func(src, typ string) maelstrom.Message {
+		msgID++
+		fmt.Fprintf(inW, `{"src": %q, "dest": "n0", "body": {"type": %q, "msg_id": %d}}`+"\n", src, typ, msgID)
+		select {
+		case msg := <-replies:
+			return msg
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no reply to %s from %s", typ, src)
+			return maelstrom.Message{}
+		}
+	}
+	request("c1", "echo")
+	request("c1", "echo")
+	request("n1", "echo")
+	request("c2", "cas")
+	reply := request("c1", "metrics")
+
+	var body metricsOK
+	if err := json.Unmarshal(reply.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	// the metrics reply goes out after the snapshot
+	want := Snapshot{
+		Sent: map[string]map[string]int{
+			"echo_ok": {"c1": 2, "n1": 1},
+			"cas_ok":  {"c2": 1}},
+		Received: map[string]map[string]int{
+			"echo":    {"c1": 2, "n1": 1},
+			"cas":     {"c2": 1},
+			"metrics": {"c1": 1}},
+		Counters: map[string]int{
+			CASFailures:     1,
+			SyncRPCTimeouts: 1},
+		Gauges: map[string]int{
+			"queue": 3}}
+	if !reflect.DeepEqual(body.Metrics, want) {
+		t.Errorf("metrics %+v, want %+v", body.Metrics, want)
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+// Upper bounds of the histogram buckets, doubling from 100µs to ~105s.
+var bucketBounds = func() []time.Duration {
+	bounds := make([]time.Duration, 21)
+	bound := 100 * time.Microsecond
+	for i := range bounds {
+		bounds[i] = bound
+		bound *= 2
+	}
+	return bounds
+}()
+
+// Histograms keeps a latency histogram per message type.
+type Histograms struct {
+	mu    sync.Mutex
+	byTyp map[string]*histogram
+}
+
+type histogram struct {
+	count int
+	sum   time.Duration
+	max   time.Duration
+	// the last bucket counts everything above the highest bound
+	buckets []int
+}
+
+type Bucket struct {
+	LE    time.Duration `json:"le"`
+	Count int           `json:"count"`
+}
+
+type HistogramSnapshot struct {
+	Count   int           `json:"count"`
+	Mean    time.Duration `json:"mean"`
+	Max     time.Duration `json:"max"`
+	Buckets []Bucket      `json:"buckets"`
+}
+
+func NewHistograms() *Histograms {
+	return &Histograms{
+		byTyp: make(map[string]*histogram)}
+}
+
+func (h *Histograms) Observe(typ string, d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hist, ok := h.byTyp[typ]
+	if !ok {
+		hist = &histogram{buckets: make([]int, len(bucketBounds)+1)}
+		h.byTyp[typ] = hist
+	}
+
+	hist.count++
+	hist.sum += d
+	hist.max = max(hist.max, d)
+
+	i := 0
+	for i < len(bucketBounds) && d > bucketBounds[i] {
+		i++
+	}
+	hist.buckets[i]++
+}
+
+// Snapshot returns the histograms by message type, leaving out empty buckets.
+func (h *Histograms) Snapshot() map[string]HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := make(map[string]HistogramSnapshot, len(h.byTyp))
+	for typ, hist := range h.byTyp {
+		s := HistogramSnapshot{
+			Count: hist.count,
+			Mean:  hist.sum / time.Duration(hist.count),
+			Max:   hist.max}
+		for i, count := range hist.buckets {
+			if count == 0 {
+				continue
+			}
+			le := hist.max
+			if i < len(bucketBounds) {
+				le = bucketBounds[i]
+			}
+			s.Buckets = append(s.Buckets, Bucket{LE: le, Count: count})
+		}
+		snapshot[typ] = s
+	}
+	return snapshot
+}
@@ -0,0 +1,147 @@
+// Package middleware wraps message handlers with shared behavior: panic
+// recovery, per-message-type timing and request logging.
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"common/api"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// Middleware wraps the handler of messages of the given type.
+type Middleware func(typ string, next maelstrom.HandlerFunc) maelstrom.HandlerFunc
+
+// Chain registers handlers with the underlying registrar wrapped in all of
+// its middlewares, the first one being the outermost.
+type Chain struct {
+	r       api.Registrar
+	mws     []Middleware
+	timings *Histograms
+}
+
+func New(r api.Registrar, mws ...Middleware) *Chain {
+	return &Chain{r: r, mws: mws}
+}
+
+// Use appends mws to the chain, they only apply to handlers registered
+// afterwards.
+func (c *Chain) Use(mws ...Middleware) {
+	c.mws = append(c.mws, mws...)
+}
+
+func (c *Chain) Handle(typ string, fn maelstrom.HandlerFunc) {
+	for i := len(c.mws) - 1; i >= 0; i-- {
+		fn = c.mws[i](typ, fn)
+	}
+	c.r.Handle(typ, fn)
+}
+
+// Timings returns the histograms collected by the timing middleware,
+// nil if it's not in use.
+func (c *Chain) Timings() *Histograms {
+	return c.timings
+}
+
+// Flush writes the collected timings, if any, to stderr as JSON.
+func (c *Chain) Flush() {
+	if c.timings == nil {
+		return
+	}
+	buf, err := json.Marshal(c.timings.Snapshot())
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+	fmt.Fprintf(os.Stderr, "timings %s\n", buf)
+}
+
+// FromEnv returns a chain with the middlewares listed in GLOMERS_MIDDLEWARE,
+// e.g. "recover,timing,log". Unknown names are reported and skipped.
+func FromEnv(r api.Registrar) *Chain {
+	return FromNames(r, strings.Split(os.Getenv("GLOMERS_MIDDLEWARE"), ","))
+}
+
+// FromNames returns a chain with the named middlewares in the given order.
+func FromNames(r api.Registrar, names []string) *Chain {
+	c := New(r)
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case "":
+		case "recover":
+			c.mws = append(c.mws, Recover())
+		case "timing":
+			c.timings = NewHistograms()
+			c.mws = append(c.mws, Timing(c.timings))
+		case "log":
+			c.mws = append(c.mws, Logging(slog.New(slog.NewJSONHandler(os.Stderr, nil))))
+		default:
+			log.Printf("unknown middleware %q", name)
+		}
+	}
+	return c
+}
+
+// Recover turns a panicking handler into a crash (code 13) error reply.
+// Panics in goroutines started by the handler aren't covered.
+func Recover() Middleware {
+	return func(typ string, next maelstrom.HandlerFunc) maelstrom.HandlerFunc {
+		return func(msg maelstrom.Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("panic handling %s: %v\n%s", typ, r, debug.Stack())
+					err = maelstrom.NewRPCError(maelstrom.Crash, fmt.Sprint(r))
+				}
+			}()
+			return next(msg)
+		}
+	}
+}
+
+// Timing records how long handlers of each message type take.
+func Timing(h *Histograms) Middleware {
+	return func(typ string, next maelstrom.HandlerFunc) maelstrom.HandlerFunc {
+		return func(msg maelstrom.Message) error {
+			start := time.Now()
+			err := next(msg)
+			h.Observe(typ, time.Since(start))
+			return err
+		}
+	}
+}
+
+// Logging logs every request and the outcome of its handling.
+func Logging(l *slog.Logger) Middleware {
+	return func(typ string, next maelstrom.HandlerFunc) maelstrom.HandlerFunc {
+		return func(msg maelstrom.Message) error {
+			l.Info("request",
+				"type", typ,
+				"src", msg.Src,
+				"dest", msg.Dest,
+				"body", msg.Body)
+
+			start := time.Now()
+			err := next(msg)
+
+			attrs := []any{
+				"type", typ,
+				"src", msg.Src,
+				"duration", time.Since(start)}
+			if err != nil {
+				attrs = append(attrs,
+					"code", maelstrom.ErrorCode(err),
+					"error", err.Error())
+			}
+			l.Info("response", attrs...)
+			return err
+		}
+	}
+}
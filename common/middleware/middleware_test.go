@@ -0,0 +1,66 @@
+//go:build go1.25
+
+package middleware
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"common/sim"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestRecover(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		nw := sim.New(sim.Config{
+			Seed:    1,
+			Latency: sim.Latency{Base: time.Millisecond},
+			Wait:    synctest.Wait})
+		n := maelstrom.NewNode()
+		// timing outside of recover, so that it sees the panicking request
+		c := FromNames(n, []string{"timing", "recover"})
+		c.Handle("boom", func(msg maelstrom.Message) error {
+			panic("boom")
+		})
+		c.Handle("echo", func(msg maelstrom.Message) error {
+			return n.Reply(msg, maelstrom.MessageBody{
+				Type: "echo_ok"})
+		})
+		nw.AddNode("n0", n)
+		if err := nw.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer nw.Close()
+
+		client := nw.Client()
+		_, err := client.Call("n0", maelstrom.MessageBody{
+			Type: "boom"}, time.Second)
+		var rpcErr *maelstrom.RPCError
+		if !errors.As(err, &rpcErr) || rpcErr.Code != maelstrom.Crash || rpcErr.Text != "boom" {
+			t.Errorf("boom got %v, want a crash error reply saying boom", err)
+		}
+
+		// the node lives on
+		if _, err := client.Call("n0", maelstrom.MessageBody{
+			Type: "echo"}, time.Second); err != nil {
+			t.Errorf("echo after the panic: %s", err)
+		}
+
+		timings := c.Timings().Snapshot()
+		if timings["boom"].Count != 1 || timings["echo"].Count != 1 {
+			t.Errorf("timings %+v, want one boom and one echo", timings)
+		}
+	})
+}
@@ -0,0 +1,297 @@
+// Package plumtree broadcasts values along a spanning tree that builds and
+// repairs itself (Leitão et al., Epidemic Broadcast Trees). It runs over
+// the neighbors of the topology, all of which start out as eager peers: a
+// new value is pushed to them right away. A node that gets a value it
+// already has from a peer prunes the link, and the peer becomes lazy on
+// both sides, so the duplicates whittle the neighbors down to a tree.
+// Unlike in the paper, a node doesn't prune a peer that recently delivered
+// it a value first, its parent: with values coming from every node at once,
+// a link redundant for the values of one node is often the shortest way for
+// those of another, and pruning on every duplicate keeps cutting nodes off
+// the tree, leaving most values to the grafts. A parent stops being one
+// when it prunes the link itself or hasn't delivered a value first for
+// parentTimeouts graft timeouts, and a peer grafted from becomes one.
+// Lazy peers are only sent ihave announcements of the new values, batched
+// every interval. A node that doesn't get an announced value within the
+// graft timeout grafts the link to the announcer back into the tree, which
+// makes the announcer push the value. Values lost along with their
+// announcements are left to anti-entropy.
+package plumtree
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"common/antientropy"
+	"common/clock"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// parentTimeouts is the number of graft timeouts a peer stays a parent for
+// after delivering a value first.
+const parentTimeouts = 4
+
+type Tree struct {
+	node         *maelstrom.Node
+	clock        clock.Clock
+	set          *antientropy.Set
+	interval     time.Duration
+	graftTimeout time.Duration
+	peers        func() []string
+	mu           sync.Mutex
+	// peers pruned from the tree, the others are eager
+	lazy map[string]bool
+	// peers that delivered a value first or were grafted from, with the
+	// time until which they aren't pruned
+	parents map[string]time.Time
+	// values not announced to the lazy peers yet
+	announce []announcement
+	// values announced but not received yet
+	missing map[float64]*wanted
+	// closed by Stop
+	stop chan struct{}
+}
+
+type announcement struct {
+	value float64
+	// peer the value came from, which doesn't need to hear of it
+	from string
+}
+
+type wanted struct {
+	// announcers not grafted yet, in the order they announced the value
+	from     []string
+	deadline time.Time
+}
+
+type pushBody struct {
+	Type  string  `json:"type"`
+	Value float64 `json:"value"`
+}
+
+type valuesBody struct {
+	Type   string    `json:"type"`
+	Values []float64 `json:"values"`
+}
+
+// New returns a tree over the nodes returned by peers, delivering values
+// into set. Announcements are flushed and grafts sent every interval.
+func New(n *maelstrom.Node, clk clock.Clock, set *antientropy.Set, interval, graftTimeout time.Duration, peers func() []string) *Tree {
+	return &Tree{
+		node:         n,
+		clock:        clk,
+		set:          set,
+		interval:     interval,
+		graftTimeout: graftTimeout,
+		peers:        peers,
+		lazy:         make(map[string]bool),
+		parents:      make(map[string]time.Time),
+		missing:      make(map[float64]*wanted),
+		stop:         make(chan struct{})}
+}
+
+// Start announces values and grafts missing ones until Stop is called.
+func (t *Tree) Start() {
+	go t.announceLoop()
+}
+
+// Stop ends the loop started by Start.
+func (t *Tree) Stop() {
+	close(t.stop)
+}
+
+// Broadcast delivers v, a value from a client.
+func (t *Tree) Broadcast(v float64) {
+	t.deliver(v, "")
+}
+
+// Lazy returns the number of peers pruned from the tree.
+func (t *Tree) Lazy() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.lazy)
+}
+
+// deliver adds v, which came from the peer from (empty for a client), and
+// pushes it to the eager peers if it's new. Returns whether it was.
+func (t *Tree) deliver(v float64, from string) bool {
+	if !t.set.Add(v) {
+		return false
+	}
+
+	t.mu.Lock()
+	delete(t.missing, v)
+	t.announce = append(t.announce, announcement{
+		value: v,
+		from:  from})
+	var eager []string
+	for _, id := range t.peers() {
+		if id != from && !t.lazy[id] {
+			eager = append(eager, id)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, id := range eager {
+		t.node.Send(id, pushBody{
+			Type:  "push",
+			Value: v})
+	}
+	return true
+}
+
+func (t *Tree) announceLoop() {
+	ticker := t.clock.NewTicker(t.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C():
+		}
+
+		now := t.clock.Now()
+		t.mu.Lock()
+		announce := t.announce
+		t.announce = nil
+		var lazy []string
+		for _, id := range t.peers() {
+			if t.lazy[id] {
+				lazy = append(lazy, id)
+			}
+		}
+		// announcer -> values to graft from it
+		grafts := make(map[string][]float64)
+		for v, w := range t.missing {
+			if now.Before(w.deadline) {
+				continue
+			}
+			if len(w.from) == 0 || t.set.Has(v) {
+				// anti-entropy will bring it, or already did
+				delete(t.missing, v)
+				continue
+			}
+			id := w.from[0]
+			w.from = w.from[1:]
+			w.deadline = now.Add(t.graftTimeout)
+			grafts[id] = append(grafts[id], v)
+			delete(t.lazy, id)
+			t.parents[id] = now.Add(parentTimeouts * t.graftTimeout)
+		}
+		t.mu.Unlock()
+
+		for _, id := range lazy {
+			var values []float64
+			for _, a := range announce {
+				if a.from != id {
+					values = append(values, a.value)
+				}
+			}
+			if len(values) > 0 {
+				t.node.Send(id, valuesBody{
+					Type:   "ihave",
+					Values: values})
+			}
+		}
+		for id, values := range grafts {
+			t.node.Send(id, valuesBody{
+				Type:   "graft",
+				Values: values})
+		}
+	}
+}
+
+// HandlePush delivers a value pushed by a peer, pruning the link if the
+// value isn't new and the peer isn't a parent. Like the other messages of
+// the tree, it isn't answered.
+func (t *Tree) HandlePush(msg maelstrom.Message) error {
+	var body pushBody
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+
+	now := t.clock.Now()
+	if t.deliver(body.Value, msg.Src) {
+		t.mu.Lock()
+		delete(t.lazy, msg.Src)
+		t.parents[msg.Src] = now.Add(parentTimeouts * t.graftTimeout)
+		t.mu.Unlock()
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if until, ok := t.parents[msg.Src]; ok {
+		if now.Before(until) {
+			return nil
+		}
+		delete(t.parents, msg.Src)
+	}
+	t.lazy[msg.Src] = true
+	t.node.Send(msg.Src, maelstrom.MessageBody{
+		Type: "prune"})
+	return nil
+}
+
+// HandlePrune takes the link to a peer that got a value twice out of the
+// tree. The peer won't push values anymore, so it isn't a parent either.
+func (t *Tree) HandlePrune(msg maelstrom.Message) error {
+	t.mu.Lock()
+	t.lazy[msg.Src] = true
+	delete(t.parents, msg.Src)
+	t.mu.Unlock()
+	return nil
+}
+
+// HandleIHave notes the values a lazy peer announced that are missing
+// here, so that they can be grafted if they don't show up in time.
+func (t *Tree) HandleIHave(msg maelstrom.Message) error {
+	var body valuesBody
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+
+	deadline := t.clock.Now().Add(t.graftTimeout)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, v := range body.Values {
+		if t.set.Has(v) {
+			continue
+		}
+		w, ok := t.missing[v]
+		if !ok {
+			w = &wanted{
+				deadline: deadline}
+			t.missing[v] = w
+		}
+		if !slices.Contains(w.from, msg.Src) {
+			w.from = append(w.from, msg.Src)
+		}
+	}
+	return nil
+}
+
+// HandleGraft puts the link to a peer back into the tree and pushes it the
+// values it's missing.
+func (t *Tree) HandleGraft(msg maelstrom.Message) error {
+	var body valuesBody
+	if err := json.Unmarshal(msg.Body, &body); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	delete(t.lazy, msg.Src)
+	t.mu.Unlock()
+	for _, v := range body.Values {
+		if t.set.Has(v) {
+			t.node.Send(msg.Src, pushBody{
+				Type:  "push",
+				Value: v})
+		}
+	}
+	return nil
+}
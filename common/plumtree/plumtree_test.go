@@ -0,0 +1,153 @@
+//go:build go1.25
+
+package plumtree
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"common/antientropy"
+	"common/sim"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// cluster is a network of fully connected trees announcing every 50ms and
+// grafting after 200ms, with the messages between the nodes recorded as
+// "src dest type".
+type cluster struct {
+	nw    *sim.Network
+	nodes []*maelstrom.Node
+	trees []*Tree
+	sets  []*antientropy.Set
+	sent  []string
+}
+
+func newCluster(t *testing.T, ids ...string) *cluster {
+	c := &cluster{
+		nw: sim.New(sim.Config{
+			Seed:    1,
+			Latency: sim.Latency{Base: 10 * time.Millisecond},
+			Wait:    synctest.Wait})}
+	for _, id := range ids {
+		n := maelstrom.NewNode()
+		set := antientropy.NewSet()
+		peers := func() []string {
+			return slices.DeleteFunc(slices.Clone(ids), func(other string) bool {
+				return other == id
+			})
+		}
+		tree := New(n, c.nw.Clock(), set, 50*time.Millisecond, 200*time.Millisecond, peers)
+		n.Handle("push", tree.HandlePush)
+		n.Handle("prune", tree.HandlePrune)
+		n.Handle("ihave", tree.HandleIHave)
+		n.Handle("graft", tree.HandleGraft)
+		c.nw.AddNode(id, n)
+		c.nodes = append(c.nodes, n)
+		c.trees = append(c.trees, tree)
+		c.sets = append(c.sets, set)
+	}
+	if err := c.nw.Start(); err != nil {
+		t.Fatal(err)
+	}
+	c.nw.Observe(func(d sim.Delivery) {
+		var body maelstrom.MessageBody
+		json.Unmarshal(d.Msg.Body, &body)
+		c.sent = append(c.sent, d.Msg.Src+" "+d.Msg.Dest+" "+body.Type)
+	})
+	for _, tree := range c.trees {
+		tree.Start()
+	}
+	t.Cleanup(func() {
+		for _, tree := range c.trees {
+			tree.Stop()
+		}
+		c.nw.Drain()
+		c.nw.Close()
+	})
+	return c
+}
+
+func TestPrune(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		c := newCluster(t, "n0", "n1", "n2")
+
+		// n1 and n2 get the value from n0 first, and then from each other
+		c.trees[0].Broadcast(1)
+		c.nw.Advance(100 * time.Millisecond)
+
+		var prunes []string
+		for _, s := range c.sent {
+			if strings.HasSuffix(s, " prune") {
+				prunes = append(prunes, s)
+			}
+		}
+		slices.Sort(prunes)
+		if want := []string{"n1 n2 prune", "n2 n1 prune"}; !slices.Equal(prunes, want) {
+			t.Errorf("prunes %v, want %v", prunes, want)
+		}
+		for i, want := range []int{0, 1, 1} {
+			if lazy := c.trees[i].Lazy(); lazy != want {
+				t.Errorf("n%d has %d lazy peers, want %d", i, lazy, want)
+			}
+		}
+
+		// the parent n0 isn't pruned for a duplicate, and the pruned link
+		// only carries announcements
+		c.sent = nil
+		c.trees[1].Broadcast(2)
+		c.nw.Advance(100 * time.Millisecond)
+		for _, s := range c.sent {
+			if s == "n1 n2 push" || s == "n2 n0 prune" {
+				t.Errorf("sent %q", s)
+			}
+		}
+		if !slices.Contains(c.sent, "n1 n2 ihave") {
+			t.Errorf("n1 didn't announce 2 to n2: %v", c.sent)
+		}
+		for i, set := range c.sets {
+			if !set.Has(2) {
+				t.Errorf("n%d is missing 2", i)
+			}
+		}
+	})
+}
+
+func TestGraft(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		c := newCluster(t, "n0", "n1")
+
+		// n0 has 7 without having pushed it, and only announces it
+		c.sets[0].Add(7)
+		c.nw.At(c.nw.Now(), func(nw *sim.Network) {
+			c.nodes[0].Send("n1", valuesBody{
+				Type:   "ihave",
+				Values: []float64{7}})
+		})
+		c.nw.Advance(150 * time.Millisecond)
+		if slices.Contains(c.sent, "n1 n0 graft") || c.sets[1].Has(7) {
+			t.Fatalf("grafted before the graft timeout: %v", c.sent)
+		}
+
+		c.nw.Advance(200 * time.Millisecond)
+		if want := []string{"n0 n1 ihave", "n1 n0 graft", "n0 n1 push"}; !slices.Equal(c.sent, want) {
+			t.Errorf("sent %v, want %v", c.sent, want)
+		}
+		if !c.sets[1].Has(7) {
+			t.Error("n1 is missing 7 after the graft")
+		}
+	})
+}
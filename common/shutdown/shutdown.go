@@ -0,0 +1,54 @@
+// Package shutdown runs the flushers of a node, e.g. dumping the metrics or
+// closing the history file, both when main returns and when the process is
+// told to stop with SIGINT or SIGTERM, which would otherwise skip the
+// deferred calls of main.
+package shutdown
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+var (
+	mu       sync.Mutex
+	flushers []func()
+	watch    sync.Once
+)
+
+// Defer registers fn to be run on shutdown. Like deferred calls, the
+// functions run in the reverse order of registering them. The first call
+// starts watching for signals, on which the functions are run and the
+// process exits.
+func Defer(fn func()) {
+	watch.Do(func() {
+		go onSignal()
+	})
+
+	mu.Lock()
+	flushers = append(flushers, fn)
+	mu.Unlock()
+}
+
+// Run runs the registered functions, each only once however often Run is
+// called. It's meant to be deferred first thing in main.
+func Run() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for len(flushers) > 0 {
+		fn := flushers[len(flushers)-1]
+		flushers = flushers[:len(flushers)-1]
+		fn()
+	}
+}
+
+func onSignal() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-sigs
+
+	Run()
+	os.Exit(128 + int(sig.(syscall.Signal)))
+}
@@ -0,0 +1,22 @@
+package shutdown
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	var ran []string
+	Defer(func() {
+		ran = append(ran, "metrics")
+	})
+	Defer(func() {
+		ran = append(ran, "history")
+	})
+
+	Run()
+	Run()
+	if want := []string{"history", "metrics"}; !slices.Equal(ran, want) {
+		t.Errorf("ran %v, want %v once each", ran, want)
+	}
+}
@@ -0,0 +1,116 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+var ErrTimeout = errors.New("sim: request timed out")
+
+// Client issues requests to the cluster, like Maelstrom's clients do.
+type Client struct {
+	nw   *Network
+	node *maelstrom.Node
+}
+
+// Client connects a new client with the next free ID (c1, c2, ...).
+func (nw *Network) Client() *Client {
+	nw.mu.Lock()
+	nw.clients++
+	id := fmt.Sprintf("c%d", nw.clients)
+	nw.mu.Unlock()
+
+	return nw.client(id)
+}
+
+func (nw *Network) client(id string) *Client {
+	n := maelstrom.NewNode()
+	nw.AddService(id, n)
+	return &Client{nw: nw, node: n}
+}
+
+func (c *Client) ID() string {
+	return c.node.ID()
+}
+
+// Send sends body to dest without waiting for anything.
+func (c *Client) Send(dest string, body any) error {
+	return c.node.Send(dest, body)
+}
+
+// Call sends a request to dest and steps the network until the response
+// arrives or timeout of virtual time passes. RPC errors in the response
+// are returned as *maelstrom.RPCError.
+func (c *Client) Call(dest string, body any, timeout time.Duration) (maelstrom.Message, error) {
+	respCh := make(chan maelstrom.Message, 1)
+	if err := c.node.RPC(dest, body, func(m maelstrom.Message) error {
+		respCh <- m
+		return nil
+	}); err != nil {
+		return maelstrom.Message{}, err
+	}
+
+	deadline := c.nw.Now() + timeout
+	for {
+		select {
+		case m := <-respCh:
+			return response(m)
+		default:
+		}
+
+		if !c.nw.stepUntil(deadline) {
+			break
+		}
+	}
+
+	// The response may have been delivered by the very last step.
+	select {
+	case m := <-respCh:
+		return response(m)
+	default:
+		log.Printf("sim: %s -> %s timed out", c.ID(), dest)
+		return maelstrom.Message{}, ErrTimeout
+	}
+}
+
+// Go sends a request to dest without waiting for the response. done is
+// called with it, RPC errors returned as *maelstrom.RPCError, once a step
+// of the network delivers it. Nothing times out, a request that's never
+// answered is never done.
+func (c *Client) Go(dest string, body any, done func(maelstrom.Message, error)) error {
+	return c.node.RPC(dest, body, func(m maelstrom.Message) error {
+		done(response(m))
+		return nil
+	})
+}
+
+// Request sends a request to dest and waits for the response in real
+// time, for networks driven by Run. It gives up once ctx is done.
+func (c *Client) Request(ctx context.Context, dest string, body any) (maelstrom.Message, error) {
+	respCh := make(chan maelstrom.Message, 1)
+	if err := c.node.RPC(dest, body, func(m maelstrom.Message) error {
+		respCh <- m
+		return nil
+	}); err != nil {
+		return maelstrom.Message{}, err
+	}
+
+	select {
+	case m := <-respCh:
+		return response(m)
+	case <-ctx.Done():
+		return maelstrom.Message{}, ErrTimeout
+	}
+}
+
+func response(m maelstrom.Message) (maelstrom.Message, error) {
+	if err := m.RPCError(); err != nil {
+		return m, err
+	}
+	return m, nil
+}
@@ -0,0 +1,587 @@
+// Package sim hosts maelstrom nodes in a single process and routes their
+// messages over a virtual network with a seeded clock, per-link latency and
+// scripted partitions, so that challenges can be run without Maelstrom.
+//
+// Events are processed one at a time: a message is delivered or the
+// clock of the nodes (see Clock) moves to the next ticker, timer or
+// deadline, and the network waits for the nodes to finish reacting to it.
+// The messages sent meanwhile are ordered by source, destination and body
+// before they get their latency and a place in the queue, so that how the
+// goroutines of the nodes happened to be scheduled doesn't matter. With
+// Config.Wait, e.g. synctest.Wait, the schedule only depends on the seed.
+package sim
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"common/clock"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// Latency describes the delay of a link: Base plus a uniformly
+// distributed, seeded jitter from [0, Jitter).
+type Latency struct {
+	Base   time.Duration
+	Jitter time.Duration
+}
+
+type Config struct {
+	// Seed of the jitter source, same seed gives the same schedule.
+	Seed uint64
+	// Latency of every link without its own, like maelstrom's --latency.
+	Latency Latency
+	// Probability of a message between two cluster members getting lost.
+	// Clients and services are never affected.
+	Loss float64
+	// Real time the network has to stay quiet before the next event is
+	// processed, so that handlers get to react to the previous one. It's
+	// only used without Wait, and a busy machine may cut it short.
+	Settle time.Duration
+	// Wait blocks until the goroutines of the hosted nodes are all idle,
+	// e.g. synctest.Wait with the network created in the bubble.
+	Wait func()
+}
+
+// Epoch is the time of the clock of the nodes when the network is created.
+var Epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Delivery is reported to observers for every message leaving the queue.
+type Delivery struct {
+	At      time.Duration
+	Msg     maelstrom.Message
+	Dropped bool
+}
+
+// Network routes messages between endpoints. Virtual time only moves
+// forward through Step, Advance, Drain, Run or Client.Call.
+type Network struct {
+	mu     sync.Mutex
+	rng    *rand.Rand
+	now    time.Duration
+	clock  *clock.Fake
+	seq    uint64
+	events eventQueue
+	// messages sent since the last event, not scheduled yet
+	outbox    []maelstrom.Message
+	endpoints map[string]*endpoint
+	nodeIDs   []string
+	latency   Latency
+	loss      float64
+	links     map[link]Latency
+	cut       map[link]struct{}
+	settle    time.Duration
+	wait      func()
+	activity  uint64
+	wake      chan struct{}
+	clients   int
+	observers []func(Delivery)
+	// wall clock and virtual time Run started at, zero unless it's running
+	runStart time.Time
+	runBase  time.Duration
+}
+
+type link struct {
+	src  string
+	dest string
+}
+
+type endpoint struct {
+	id string
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+func New(cfg Config) *Network {
+	if cfg.Settle == 0 {
+		cfg.Settle = time.Millisecond
+	}
+
+	return &Network{
+		rng:       rand.New(rand.NewPCG(cfg.Seed, cfg.Seed)),
+		clock:     clock.NewFake(Epoch),
+		endpoints: make(map[string]*endpoint),
+		latency:   cfg.Latency,
+		loss:      cfg.Loss,
+		links:     make(map[link]Latency),
+		cut:       make(map[link]struct{}),
+		settle:    cfg.Settle,
+		wait:      cfg.Wait,
+		wake:      make(chan struct{}, 1)}
+}
+
+// AddNode connects n to the network as a cluster member with the given ID.
+// The node receives its init message from Start.
+func (nw *Network) AddNode(id string, n *maelstrom.Node) {
+	nw.mu.Lock()
+	nw.nodeIDs = append(nw.nodeIDs, id)
+	nw.mu.Unlock()
+
+	nw.run(id, n)
+}
+
+// AddService connects n as a service (e.g. a key/value store) that is not
+// a part of the cluster and doesn't need an init message.
+func (nw *Network) AddService(id string, n *maelstrom.Node) {
+	n.Init(id, nil)
+	nw.run(id, n)
+}
+
+// Attach connects a raw endpoint: messages for id are written to w as JSON
+// lines and every line read from r is sent into the network.
+func (nw *Network) Attach(id string, w io.WriteCloser, r io.Reader) {
+	nw.mu.Lock()
+	nw.endpoints[id] = &endpoint{id: id, w: w}
+	nw.mu.Unlock()
+
+	go nw.read(id, r)
+}
+
+// AttachNode connects a raw endpoint, e.g. the stdio of a child process,
+// as a cluster member. Like AddNode, it receives its init message from
+// Start.
+func (nw *Network) AttachNode(id string, w io.WriteCloser, r io.Reader) {
+	nw.mu.Lock()
+	nw.nodeIDs = append(nw.nodeIDs, id)
+	nw.mu.Unlock()
+
+	nw.Attach(id, w, r)
+}
+
+func (nw *Network) run(id string, n *maelstrom.Node) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	n.Stdin = inR
+	n.Stdout = outW
+
+	nw.Attach(id, inW, outR)
+
+	go func() {
+		if err := n.Run(); err != nil {
+			log.Printf("sim: node %s: %s", id, err)
+		}
+		outW.Close()
+	}()
+}
+
+func (nw *Network) read(id string, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var msg maelstrom.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("sim: endpoint %s: %s", id, err)
+			continue
+		}
+		nw.enqueue(msg)
+	}
+}
+
+// NodeIDs returns the IDs of all cluster members in the order of addition.
+func (nw *Network) NodeIDs() []string {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	return append([]string(nil), nw.nodeIDs...)
+}
+
+// Clock returns the clock the hosted nodes should use. It follows the
+// virtual time, starting at Epoch, and fires tickers, timers and
+// deadlines as events of their own.
+func (nw *Network) Clock() clock.Clock {
+	return nw.clock
+}
+
+// Now returns the virtual time elapsed since the network was created.
+func (nw *Network) Now() time.Duration {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	return nw.current()
+}
+
+// current is the virtual time, which follows the wall clock between
+// events while Run drives the network. mu must be held.
+func (nw *Network) current() time.Duration {
+	if !nw.runStart.IsZero() {
+		if t := nw.runBase + time.Since(nw.runStart); t > nw.now {
+			return t
+		}
+	}
+	return nw.now
+}
+
+// Observe registers fn to be called for every delivered or dropped message.
+func (nw *Network) Observe(fn func(Delivery)) {
+	nw.mu.Lock()
+	nw.observers = append(nw.observers, fn)
+	nw.mu.Unlock()
+}
+
+// SetLatency overrides the latency of the link from src to dest.
+func (nw *Network) SetLatency(src, dest string, l Latency) {
+	nw.mu.Lock()
+	nw.links[link{src, dest}] = l
+	nw.mu.Unlock()
+}
+
+// Partition cuts all links between nodes of different groups. Links to
+// clients and services are left intact, same as in Maelstrom.
+func (nw *Network) Partition(groups ...[]string) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	for i, a := range groups {
+		for j, b := range groups {
+			if i == j {
+				continue
+			}
+			for _, src := range a {
+				for _, dest := range b {
+					nw.cut[link{src, dest}] = struct{}{}
+				}
+			}
+		}
+	}
+}
+
+// Isolate cuts id off from all the other cluster members.
+func (nw *Network) Isolate(id string) {
+	var rest []string
+	for _, other := range nw.NodeIDs() {
+		if other != id {
+			rest = append(rest, other)
+		}
+	}
+	nw.Partition([]string{id}, rest)
+}
+
+// Heal removes all partitions.
+func (nw *Network) Heal() {
+	nw.mu.Lock()
+	nw.cut = make(map[link]struct{})
+	nw.mu.Unlock()
+}
+
+// At schedules fn to be run once the virtual clock reaches at. It's meant
+// for scripting partitions, e.g. nw.At(5*time.Second, (*Network).Heal).
+func (nw *Network) At(at time.Duration, fn func(*Network)) {
+	nw.mu.Lock()
+	nw.push(&event{at: at, fn: fn})
+	nw.mu.Unlock()
+}
+
+// Start sends init messages to all cluster members and waits for them to
+// be acknowledged.
+func (nw *Network) Start() error {
+	c := nw.client("c0")
+	nodeIDs := nw.NodeIDs()
+
+	for _, id := range nodeIDs {
+		if _, err := c.Call(id, initBody(id, nodeIDs), time.Minute); err != nil {
+			return fmt.Errorf("init %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// StartRunning is Start for a network driven by Run, the init messages
+// are acknowledged in real time.
+func (nw *Network) StartRunning(ctx context.Context) error {
+	c := nw.client("c0")
+	nodeIDs := nw.NodeIDs()
+
+	for _, id := range nodeIDs {
+		if _, err := c.Request(ctx, id, initBody(id, nodeIDs)); err != nil {
+			return fmt.Errorf("init %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func initBody(id string, nodeIDs []string) maelstrom.InitMessageBody {
+	return maelstrom.InitMessageBody{
+		MessageBody: maelstrom.MessageBody{Type: "init"},
+		NodeID:      id,
+		NodeIDs:     nodeIDs}
+}
+
+// Close disconnects all endpoints, which makes the hosted nodes return
+// from Run.
+func (nw *Network) Close() {
+	nw.mu.Lock()
+	endpoints := make([]*endpoint, 0, len(nw.endpoints))
+	for _, ep := range nw.endpoints {
+		endpoints = append(endpoints, ep)
+	}
+	nw.mu.Unlock()
+
+	for _, ep := range endpoints {
+		ep.w.Close()
+	}
+}
+
+func (nw *Network) enqueue(msg maelstrom.Message) {
+	nw.mu.Lock()
+	nw.outbox = append(nw.outbox, msg)
+	nw.activity++
+	nw.mu.Unlock()
+
+	select {
+	case nw.wake <- struct{}{}:
+	default:
+	}
+}
+
+// flush schedules the messages of the outbox, sent at the current virtual
+// time, in the order of source, destination and body.
+func (nw *Network) flush() {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	slices.SortStableFunc(nw.outbox, func(a, b maelstrom.Message) int {
+		return cmp.Or(
+			cmp.Compare(a.Src, b.Src),
+			cmp.Compare(a.Dest, b.Dest),
+			bytes.Compare(a.Body, b.Body))
+	})
+	now := nw.current()
+	for _, msg := range nw.outbox {
+		l, ok := nw.links[link{msg.Src, msg.Dest}]
+		if !ok {
+			l = nw.latency
+		}
+		delay := l.Base
+		if l.Jitter > 0 {
+			delay += time.Duration(nw.rng.Int64N(int64(l.Jitter)))
+		}
+		nw.push(&event{at: now + delay, msg: msg})
+	}
+	nw.outbox = nil
+}
+
+// push has to be called with mu held.
+func (nw *Network) push(ev *event) {
+	nw.seq++
+	ev.seq = nw.seq
+	heap.Push(&nw.events, ev)
+}
+
+// quiesce blocks until the nodes are done reacting to the last event, and
+// schedules the messages they sent.
+func (nw *Network) quiesce() {
+	defer nw.flush()
+
+	if nw.wait != nil {
+		nw.wait()
+		return
+	}
+	// no new message for the settle period has to do
+	for {
+		nw.mu.Lock()
+		before := nw.activity
+		nw.mu.Unlock()
+
+		time.Sleep(nw.settle)
+
+		nw.mu.Lock()
+		after := nw.activity
+		nw.mu.Unlock()
+		if before == after {
+			return
+		}
+	}
+}
+
+// next pops the earliest event if it's due no later than deadline. The
+// clock of the nodes being due before it, or at the same time, comes first
+// as an event of its own.
+func (nw *Network) next(deadline time.Duration) *event {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	at, timer := nw.clock.Next()
+	due := at.Sub(Epoch)
+	if nw.events.Len() > 0 && (!timer || nw.events[0].at < due) {
+		timer = false
+		due = nw.events[0].at
+	} else if !timer {
+		return nil
+	}
+	if due > deadline {
+		return nil
+	}
+	if due > nw.now {
+		nw.now = due
+	}
+	if timer {
+		return &event{at: due}
+	}
+	return heap.Pop(&nw.events).(*event)
+}
+
+func (nw *Network) fire(ev *event) {
+	nw.tick(ev.at)
+	switch {
+	case ev.fn != nil:
+		ev.fn(nw)
+		return
+	case ev.msg.Dest == "":
+		// only the clock was due
+		return
+	}
+
+	nw.mu.Lock()
+	_, isCut := nw.cut[link{ev.msg.Src, ev.msg.Dest}]
+	lost := nw.loss > 0 && nw.isMember(ev.msg.Src) && nw.isMember(ev.msg.Dest) &&
+		nw.rng.Float64() < nw.loss
+	ep := nw.endpoints[ev.msg.Dest]
+	observers := nw.observers
+	now := nw.now
+	nw.mu.Unlock()
+
+	dropped := isCut || lost || ep == nil
+	if !dropped {
+		if err := ep.write(ev.msg); err != nil {
+			log.Printf("sim: deliver to %s: %s", ev.msg.Dest, err)
+			dropped = true
+		}
+	}
+
+	for _, fn := range observers {
+		fn(Delivery{At: now, Msg: ev.msg, Dropped: dropped})
+	}
+}
+
+// tick moves the clock of the nodes forward to the virtual time at, firing
+// whatever is due by then.
+func (nw *Network) tick(at time.Duration) {
+	if t := Epoch.Add(at); t.After(nw.clock.Now()) {
+		nw.clock.Set(t)
+	}
+}
+
+// isMember has to be called with mu held.
+func (nw *Network) isMember(id string) bool {
+	return slices.Contains(nw.nodeIDs, id)
+}
+
+func (ep *endpoint) write(msg maelstrom.Message) error {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	_, err = ep.w.Write(append(buf, '\n'))
+	return err
+}
+
+// Step processes the next event, advancing the virtual clock to it, and
+// waits for the nodes to react. Returns false if there are no more events
+// and nothing is waiting for the clock.
+func (nw *Network) Step() bool {
+	return nw.stepUntil(maxDuration)
+}
+
+func (nw *Network) stepUntil(deadline time.Duration) bool {
+	nw.quiesce()
+	ev := nw.next(deadline)
+	if ev == nil {
+		return false
+	}
+	nw.fire(ev)
+	nw.quiesce()
+	return true
+}
+
+// Advance processes all events due within d and moves the virtual clock
+// forward by d.
+func (nw *Network) Advance(d time.Duration) {
+	deadline := nw.Now() + d
+	for nw.stepUntil(deadline) {
+	}
+
+	nw.mu.Lock()
+	if nw.now < deadline {
+		nw.now = deadline
+	}
+	nw.mu.Unlock()
+	nw.tick(deadline)
+	nw.quiesce()
+}
+
+// Drain steps until no message is in flight and nothing waits for the
+// clock anymore, e.g. once the loops of the nodes are stopped, so that
+// they can be shut down without leaving goroutines behind. It never
+// returns while a ticker is running.
+func (nw *Network) Drain() {
+	for nw.Step() {
+	}
+}
+
+// Run processes events in real time, i.e. the virtual clock follows the
+// wall clock, until ctx is done. This is meant for driving processes that
+// keep their own time.
+func (nw *Network) Run(ctx context.Context) error {
+	nw.mu.Lock()
+	start := time.Now()
+	base := nw.now
+	nw.runStart, nw.runBase = start, base
+	nw.mu.Unlock()
+	defer func() {
+		nw.mu.Lock()
+		nw.now = nw.current()
+		nw.runStart = time.Time{}
+		nw.mu.Unlock()
+	}()
+
+	for {
+		nw.flush()
+		elapsed := base + time.Since(start)
+		for {
+			ev := nw.next(elapsed)
+			if ev == nil {
+				break
+			}
+			nw.fire(ev)
+		}
+
+		nw.mu.Lock()
+		if nw.now < elapsed {
+			nw.now = elapsed
+		}
+		wait := time.Hour
+		if nw.events.Len() > 0 {
+			wait = nw.events[0].at - elapsed
+		}
+		if at, ok := nw.clock.Next(); ok {
+			wait = min(wait, at.Sub(Epoch)-elapsed)
+		}
+		nw.mu.Unlock()
+		nw.tick(elapsed)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-nw.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+const maxDuration = time.Duration(1<<63 - 1)
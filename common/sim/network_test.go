@@ -0,0 +1,173 @@
+//go:build go1.25
+
+package sim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"common/api"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// chatter adds nodes that, asked to "start", send a "hello" to every other
+// node from a goroutine of its own, and answer a hello with a "hello_ok"
+// once the ticker of the node ticked. The hellos are given a second to be
+// answered.
+func chatter(nw *Network, ids ...string) []*maelstrom.Node {
+	var nodes []*maelstrom.Node
+	for _, id := range ids {
+		n := maelstrom.NewNode()
+		clk := nw.Clock()
+		ticker := clk.NewTicker(300 * time.Millisecond)
+		stop := make(chan struct{})
+		ticks := make(chan struct{})
+		go func() {
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					close(ticks)
+					return
+				case <-ticker.C():
+				}
+				select {
+				case ticks <- struct{}{}:
+				default:
+				}
+			}
+		}()
+
+		n.Handle("start", func(msg maelstrom.Message) error {
+			for _, other := range n.NodeIDs() {
+				if other == n.ID() {
+					continue
+				}
+				go func() {
+					ctx, cancel := clk.WithTimeout(context.Background(), time.Second)
+					defer cancel()
+					api.SyncRPC(ctx, n, other, maelstrom.MessageBody{Type: "hello"})
+				}()
+			}
+			return n.Reply(msg, maelstrom.MessageBody{Type: "start_ok"})
+		})
+		n.Handle("hello", func(msg maelstrom.Message) error {
+			<-ticks
+			return n.Reply(msg, maelstrom.MessageBody{Type: "hello_ok"})
+		})
+		n.Handle("stop", func(msg maelstrom.Message) error {
+			close(stop)
+			return n.Reply(msg, maelstrom.MessageBody{Type: "stop_ok"})
+		})
+		nw.AddNode(id, n)
+		nodes = append(nodes, n)
+	}
+	return nodes
+}
+
+// schedule runs the chatter of five nodes and returns every delivery, with
+// the message IDs left out, which depend on the order the goroutines of a
+// node send in.
+func schedule(t *testing.T, seed uint64) []string {
+	var deliveries []string
+	synctest.Test(t, func(t *testing.T) {
+		nw := New(Config{
+			Seed:    seed,
+			Latency: Latency{Base: 10 * time.Millisecond, Jitter: 50 * time.Millisecond},
+			Loss:    0.2,
+			Wait:    synctest.Wait})
+		ids := []string{"n0", "n1", "n2", "n3", "n4"}
+		chatter(nw, ids...)
+		nw.Observe(func(d Delivery) {
+			var body maelstrom.MessageBody
+			json.Unmarshal(d.Msg.Body, &body)
+			deliveries = append(deliveries, fmt.Sprintf("%s %s->%s %s dropped=%t", d.At, d.Msg.Src, d.Msg.Dest, body.Type, d.Dropped))
+		})
+		if err := nw.Start(); err != nil {
+			t.Fatal(err)
+		}
+
+		c := nw.Client()
+		for _, id := range ids {
+			if _, err := c.Call(id, maelstrom.MessageBody{Type: "start"}, time.Second); err != nil {
+				t.Fatal(err)
+			}
+		}
+		nw.Advance(2 * time.Second)
+		for _, id := range ids {
+			if _, err := c.Call(id, maelstrom.MessageBody{Type: "stop"}, time.Second); err != nil {
+				t.Fatal(err)
+			}
+		}
+		nw.Drain()
+		nw.Close()
+	})
+	return deliveries
+}
+
+func TestDeterministic(t *testing.T) {
+	first := schedule(t, 1)
+	for range 5 {
+		if again := schedule(t, 1); !slices.Equal(again, first) {
+			t.Fatalf("same seed, different schedule:\n%v\n%v", first, again)
+		}
+	}
+	if slices.Equal(schedule(t, 2), first) {
+		t.Error("different seed, same schedule")
+	}
+}
+
+func TestClock(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		nw := New(Config{
+			Latency: Latency{Base: 100 * time.Millisecond},
+			Wait:    synctest.Wait})
+		n := maelstrom.NewNode()
+		n.Handle("sleep", func(msg maelstrom.Message) error {
+			<-nw.Clock().After(time.Second)
+			return n.Reply(msg, maelstrom.MessageBody{Type: "sleep_ok"})
+		})
+		nw.AddNode("n0", n)
+		if err := nw.Start(); err != nil {
+			t.Fatal(err)
+		}
+
+		c := nw.Client()
+		start := nw.Now()
+		if _, err := c.Call("n0", maelstrom.MessageBody{Type: "sleep"}, 5*time.Second); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := nw.Now() - start; elapsed != 1200*time.Millisecond {
+			t.Errorf("answered after %s, want 1.2s", elapsed)
+		}
+		if now := nw.Clock().Now(); !now.Equal(Epoch.Add(nw.Now())) {
+			t.Errorf("clock of the nodes at %s, want %s", now, Epoch.Add(nw.Now()))
+		}
+
+		// the timeout passes before the answer arrives
+		start = nw.Now()
+		if _, err := c.Call("n0", maelstrom.MessageBody{Type: "sleep"}, time.Second); err != ErrTimeout {
+			t.Errorf("got %v, want a timeout", err)
+		}
+		nw.Drain()
+		if elapsed := nw.Now() - start; elapsed != 1200*time.Millisecond {
+			t.Errorf("drained after %s, want 1.2s", elapsed)
+		}
+		nw.Close()
+	})
+}
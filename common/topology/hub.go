@@ -0,0 +1,170 @@
+package topology
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"common/api"
+	"common/clock"
+	"common/health"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// Hub tracks which node is the hub of the star topology from the point of
+// view of one node. The preferred hub is the central node; a node that
+// times out on failures RPCs in a row is passed over in favor of the next
+// node of the IDs of init, and probed every recheck until it answers again,
+// so that the nodes return to a single hub once a partition heals. Nodes
+// the failure detector suspects are passed over as well, without waiting
+// for RPCs to time out. It costs no messages as long as the hub answers.
+type Hub struct {
+	node     *maelstrom.Node
+	clock    clock.Clock
+	health   *health.Detector
+	hub      string
+	failures int
+	recheck  time.Duration
+	mu       sync.Mutex
+	// node -> RPCs timed out in a row
+	failed map[string]int
+	// node -> when the last RPC it answered was sent
+	answered map[string]time.Time
+	// nodes passed over as the hub
+	suspected map[string]bool
+	// closed by Stop
+	stop chan struct{}
+}
+
+// NewHub returns the hub tracker of n, with hub as the preferred hub,
+// consulting hd about which nodes are down. A probe has until the next one
+// to be answered.
+func NewHub(n *maelstrom.Node, clk clock.Clock, hd *health.Detector, hub string, failures int, recheck time.Duration) *Hub {
+	return &Hub{
+		node:      n,
+		clock:     clk,
+		health:    hd,
+		hub:       hub,
+		failures:  failures,
+		recheck:   recheck,
+		failed:    make(map[string]int),
+		answered:  make(map[string]time.Time),
+		suspected: make(map[string]bool),
+		stop:      make(chan struct{})}
+}
+
+// Start probes the nodes passed over until Stop is called.
+func (h *Hub) Start() {
+	go h.recheckLoop()
+}
+
+// Stop ends the loop started by Start.
+func (h *Hub) Stop() {
+	close(h.stop)
+}
+
+// Current returns the hub, which is the node itself if it was the only one
+// left.
+func (h *Hub) Current() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.current()
+}
+
+func (h *Hub) current() string {
+	nodes := rooted(h.node.NodeIDs(), h.hub)
+	if len(nodes) == 0 {
+		return h.hub
+	}
+	for _, id := range nodes {
+		if id == h.node.ID() || !h.suspected[id] && !h.health.Suspected(id) {
+			return id
+		}
+	}
+	return h.node.ID()
+}
+
+// Observe takes the outcome of an RPC sent to id at sent into account.
+// Only timeouts count as failures, an error reply means the node is
+// reachable. Timeouts of RPCs sent before one that got answered are stale,
+// e.g. from before a partition healed, and don't count either.
+func (h *Hub) Observe(id string, sent time.Time, err error) {
+	var rpcErr *maelstrom.RPCError
+	reachable := err == nil || errors.As(err, &rpcErr)
+	if !reachable && !errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if reachable {
+		if sent.After(h.answered[id]) {
+			h.answered[id] = sent
+		}
+		h.failed[id] = 0
+		if h.suspected[id] {
+			delete(h.suspected, id)
+			if h.current() == id {
+				log.Printf("hub: %s is reachable again, back to it", id)
+			}
+		}
+		return
+	}
+
+	if !sent.After(h.answered[id]) {
+		return
+	}
+	h.failed[id]++
+	if h.failed[id] < h.failures || h.suspected[id] {
+		return
+	}
+	prev := h.current()
+	h.suspected[id] = true
+	if prev == id {
+		log.Printf("hub: %s timed out %d times, failing over to %s", id, h.failed[id], h.current())
+	}
+}
+
+// passedOver returns the nodes preferred over the current hub.
+func (h *Hub) passedOver() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	nodes := rooted(h.node.NodeIDs(), h.hub)
+	i := slices.Index(nodes, h.current())
+	if i < 0 {
+		return nil
+	}
+	return slices.Clone(nodes[:i])
+}
+
+func (h *Hub) recheckLoop() {
+	ticker := h.clock.NewTicker(h.recheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C():
+		}
+
+		for _, id := range h.passedOver() {
+			go h.probe(id)
+		}
+	}
+}
+
+func (h *Hub) probe(id string) {
+	ctx, cancel := h.clock.WithTimeout(context.Background(), h.recheck)
+	defer cancel()
+	sent := h.clock.Now()
+	_, err := api.SyncRPC(ctx, h.node, id, maelstrom.MessageBody{
+		Type: "probe"})
+	h.Observe(id, sent, err)
+}
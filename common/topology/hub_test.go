@@ -0,0 +1,99 @@
+//go:build go1.25
+
+package topology
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"common/health"
+	"common/sim"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func TestHub(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		nw := sim.New(sim.Config{
+			Seed:    1,
+			Latency: sim.Latency{Base: 10 * time.Millisecond},
+			Wait:    synctest.Wait})
+		var h *Hub
+		for _, id := range []string{"n0", "n1", "n2"} {
+			n := maelstrom.NewNode()
+			hd := health.New(n, nw.Clock(), 0, 0, 8)
+			n.Handle("probe", hd.HandleProbe)
+			if id == "n2" {
+				h = NewHub(n, nw.Clock(), hd, "n0", 2, 500*time.Millisecond)
+			}
+			nw.AddNode(id, n)
+		}
+		if err := nw.Start(); err != nil {
+			t.Fatal(err)
+		}
+		h.Start()
+		defer func() {
+			h.Stop()
+			nw.Drain()
+			nw.Close()
+		}()
+
+		// one RPC timing out every 100ms
+		timeout := func(id string) {
+			nw.Advance(100 * time.Millisecond)
+			h.Observe(id, nw.Clock().Now(), context.DeadlineExceeded)
+		}
+		if hub := h.Current(); hub != "n0" {
+			t.Fatalf("hub %s, want n0", hub)
+		}
+
+		nw.Isolate("n0")
+		timeout("n0")
+		if hub := h.Current(); hub != "n0" {
+			t.Errorf("hub %s after one timeout, want n0", hub)
+		}
+		// an error reply means the hub is reachable
+		nw.Advance(100 * time.Millisecond)
+		h.Observe("n0", nw.Clock().Now(), maelstrom.NewRPCError(maelstrom.Crash, "crash"))
+		timeout("n0")
+		if hub := h.Current(); hub != "n0" {
+			t.Errorf("hub %s after an error reply and a timeout, want n0", hub)
+		}
+		timeout("n0")
+		if hub := h.Current(); hub != "n1" {
+			t.Errorf("hub %s after two timeouts in a row, want n1", hub)
+		}
+
+		// the rechecks of n0 time out while it's cut off
+		nw.Advance(2 * time.Second)
+		if hub := h.Current(); hub != "n1" {
+			t.Errorf("hub %s while n0 is cut off, want n1", hub)
+		}
+
+		nw.Heal()
+		nw.Advance(time.Second)
+		if hub := h.Current(); hub != "n0" {
+			t.Errorf("hub %s once n0 answers a recheck, want n0", hub)
+		}
+
+		// timeouts of RPCs sent before the answered recheck are stale
+		sent := nw.Clock().Now().Add(-2 * time.Second)
+		for range 3 {
+			h.Observe("n0", sent, context.DeadlineExceeded)
+		}
+		if hub := h.Current(); hub != "n0" {
+			t.Errorf("hub %s after stale timeouts, want n0", hub)
+		}
+	})
+}
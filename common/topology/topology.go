@@ -0,0 +1,160 @@
+// Package topology computes the neighbors a broadcast node passes values
+// on to. The strategy is picked by name with -topology:
+//
+//   - maelstrom: the neighbors Maelstrom sends in the topology message
+//   - star: the hub (-central-node) and every other node
+//   - tree: a k-ary tree rooted at the hub, k set by -tree-fanout
+//   - grid: a 2D grid, the nodes above, below, left and right
+//   - ring: a ring plus chords to the nodes 2, 4, 8, ... positions away,
+//     up to -ring-chords of them in each direction
+//   - mesh: every other node
+//
+// Fewer neighbors mean fewer messages per operation but more hops, and so
+// higher latency. All strategies but maelstrom compute the neighbors from
+// the node IDs of init, in the order Maelstrom lists them, so the nodes
+// agree on the topology without talking to each other. Neighbors are
+// symmetric: if a is a neighbor of b, b is one of a.
+package topology
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Strategy names accepted by New.
+const (
+	Maelstrom = "maelstrom"
+	Star      = "star"
+	Tree      = "tree"
+	Grid      = "grid"
+	Ring      = "ring"
+	Mesh      = "mesh"
+)
+
+// Strategy returns the neighbors of self given the IDs of all nodes and the
+// topology Maelstrom sent.
+type Strategy func(self string, nodes []string, given map[string][]string) []string
+
+// New returns the strategy called name. The hub is the center of the star
+// and the root of the tree; if it isn't one of the nodes, the first node
+// takes its place.
+func New(name, hub string, fanout, chords int) (Strategy, error) {
+	switch name {
+	case Maelstrom:
+		return func(self string, nodes []string, given map[string][]string) []string {
+			return given[self]
+		}, nil
+	case Star:
+		return func(self string, nodes []string, given map[string][]string) []string {
+			return star(self, rooted(nodes, hub))
+		}, nil
+	case Tree:
+		if fanout < 1 {
+			return nil, fmt.Errorf("topology: tree fanout must be at least 1, got %d", fanout)
+		}
+		return func(self string, nodes []string, given map[string][]string) []string {
+			return tree(self, rooted(nodes, hub), fanout)
+		}, nil
+	case Grid:
+		return func(self string, nodes []string, given map[string][]string) []string {
+			return grid(self, nodes)
+		}, nil
+	case Ring:
+		if chords < 0 {
+			return nil, fmt.Errorf("topology: ring chords must not be negative, got %d", chords)
+		}
+		return func(self string, nodes []string, given map[string][]string) []string {
+			return ring(self, nodes, chords)
+		}, nil
+	case Mesh:
+		return func(self string, nodes []string, given map[string][]string) []string {
+			return slices.DeleteFunc(slices.Clone(nodes), func(id string) bool {
+				return id == self
+			})
+		}, nil
+	}
+	return nil, fmt.Errorf("topology: unknown strategy %q", name)
+}
+
+// rooted returns nodes with the hub moved to the front.
+func rooted(nodes []string, hub string) []string {
+	i := slices.Index(nodes, hub)
+	if i <= 0 {
+		return nodes
+	}
+	res := []string{hub}
+	res = append(res, nodes[:i]...)
+	return append(res, nodes[i+1:]...)
+}
+
+func star(self string, nodes []string) []string {
+	if len(nodes) == 0 {
+		return nil
+	}
+	if self == nodes[0] {
+		return slices.Clone(nodes[1:])
+	}
+	return []string{nodes[0]}
+}
+
+// tree lays nodes out as a heap: the parent of node i is (i-1)/k, its
+// children are k*i+1 to k*i+k.
+func tree(self string, nodes []string, k int) []string {
+	i := slices.Index(nodes, self)
+	if i < 0 {
+		return nil
+	}
+
+	var res []string
+	if i > 0 {
+		res = append(res, nodes[(i-1)/k])
+	}
+	for c := k*i + 1; c <= k*i+k && c < len(nodes); c++ {
+		res = append(res, nodes[c])
+	}
+	return res
+}
+
+// grid lays nodes out row by row in a square just wide enough to hold them,
+// the last row may be partial.
+func grid(self string, nodes []string) []string {
+	i := slices.Index(nodes, self)
+	if i < 0 {
+		return nil
+	}
+	width := int(math.Ceil(math.Sqrt(float64(len(nodes)))))
+
+	var res []string
+	if i-width >= 0 {
+		res = append(res, nodes[i-width])
+	}
+	if i+width < len(nodes) {
+		res = append(res, nodes[i+width])
+	}
+	if i%width > 0 {
+		res = append(res, nodes[i-1])
+	}
+	if i%width < width-1 && i+1 < len(nodes) {
+		res = append(res, nodes[i+1])
+	}
+	return res
+}
+
+func ring(self string, nodes []string, chords int) []string {
+	i := slices.Index(nodes, self)
+	if i < 0 {
+		return nil
+	}
+	n := len(nodes)
+
+	var res []string
+	for d := 1; d < n && d <= 1<<chords; d *= 2 {
+		for _, j := range []int{(i + d) % n, (i - d + n) % n} {
+			if j != i && !slices.Contains(res, nodes[j]) {
+				res = append(res, nodes[j])
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,76 @@
+package topology
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestSymmetric(t *testing.T) {
+	tests := []struct {
+		name   string
+		fanout int
+		chords int
+	}{
+		{Star, 0, 0},
+		{Tree, 1, 0},
+		{Tree, 2, 0},
+		{Tree, 3, 0},
+		{Grid, 0, 0},
+		{Ring, 0, 0},
+		{Ring, 0, 1},
+		{Ring, 0, 3},
+		{Mesh, 0, 0}}
+
+	for _, tt := range tests {
+		for _, n := range []int{1, 2, 3, 5, 8, 10, 16, 25} {
+			t.Run(fmt.Sprintf("%s fanout %d chords %d n %d", tt.name, tt.fanout, tt.chords, n), func(t *testing.T) {
+				nodes := make([]string, n)
+				for i := range nodes {
+					nodes[i] = fmt.Sprintf("n%d", i)
+				}
+				// the hub in the middle, so that the order changes
+				strategy, err := New(tt.name, nodes[n/2], tt.fanout, tt.chords)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				neighbors := make(map[string][]string)
+				for _, id := range nodes {
+					neighbors[id] = strategy(id, nodes, nil)
+				}
+				for _, a := range nodes {
+					if slices.Contains(neighbors[a], a) {
+						t.Errorf("%s is its own neighbor", a)
+					}
+					sorted := slices.Sorted(slices.Values(neighbors[a]))
+					if len(slices.Compact(sorted)) != len(neighbors[a]) {
+						t.Errorf("duplicate neighbors of %s: %v", a, neighbors[a])
+					}
+					for _, b := range neighbors[a] {
+						if !slices.Contains(neighbors[b], a) {
+							t.Errorf("%s is a neighbor of %s but not the other way round", b, a)
+						}
+					}
+				}
+
+				// every node reachable from the first
+				seen := map[string]bool{nodes[0]: true}
+				queue := []string{nodes[0]}
+				for len(queue) > 0 {
+					id := queue[0]
+					queue = queue[1:]
+					for _, next := range neighbors[id] {
+						if !seen[next] {
+							seen[next] = true
+							queue = append(queue, next)
+						}
+					}
+				}
+				if len(seen) != n {
+					t.Errorf("%d of %d nodes reachable", len(seen), n)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// KV is a client to a key/value service, same as maelstrom.KV, whose
+// requests are made within the span carried by the context.
+type KV struct {
+	typ    string
+	tracer *Tracer
+}
+
+type kvReadBody struct {
+	Type string `json:"type"`
+	Key  string `json:"key"`
+}
+
+type kvReadOKBody struct {
+	Value any `json:"value"`
+}
+
+type kvWriteBody struct {
+	Type  string `json:"type"`
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+type kvCASBody struct {
+	Type              string `json:"type"`
+	Key               string `json:"key"`
+	From              any    `json:"from"`
+	To                any    `json:"to"`
+	CreateIfNotExists bool   `json:"create_if_not_exists,omitempty"`
+}
+
+// KV returns a client to the key/value service of the given type, e.g.
+// maelstrom.LinKV.
+func (t *Tracer) KV(typ string) *KV {
+	return &KV{typ: typ, tracer: t}
+}
+
+// Read returns the value of key, numbers converted to int.
+func (kv *KV) Read(ctx context.Context, key string) (any, error) {
+	res, err := kv.tracer.SyncRPC(ctx, kv.typ, kvReadBody{
+		Type: "read",
+		Key:  key})
+	if err != nil {
+		return nil, err
+	}
+
+	var body kvReadOKBody
+	if err := json.Unmarshal(res.Body, &body); err != nil {
+		return nil, err
+	}
+
+	switch v := body.Value.(type) {
+	case float64:
+		return int(v), nil
+	default:
+		return v, nil
+	}
+}
+
+func (kv *KV) Write(ctx context.Context, key string, value any) error {
+	_, err := kv.tracer.SyncRPC(ctx, kv.typ, kvWriteBody{
+		Type:  "write",
+		Key:   key,
+		Value: value})
+	return err
+}
+
+func (kv *KV) CompareAndSwap(ctx context.Context, key string, from, to any, createIfNotExists bool) error {
+	_, err := kv.tracer.SyncRPC(ctx, kv.typ, kvCASBody{
+		Type:              "cas",
+		Key:               key,
+		From:              from,
+		To:                to,
+		CreateIfNotExists: createIfNotExists})
+	return err
+}
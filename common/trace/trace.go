@@ -0,0 +1,283 @@
+// Package trace ties the messages exchanged by the nodes back to the client
+// requests that caused them. A trace ID and span ID are attached to the
+// bodies of outgoing requests, and every handled message and outgoing
+// request is recorded as a span in a per-node JSON-lines file.
+//
+// Tracing is enabled by setting GLOMERS_TRACE_DIR, otherwise bodies are
+// sent unchanged and nothing is recorded.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"common/api"
+	"common/middleware"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// SpanContext identifies a span across nodes.
+type SpanContext struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+}
+
+// Span is a single record of a trace file.
+type Span struct {
+	SpanContext
+	ParentID string `json:"parent_id,omitempty"`
+	// spans of other traces that caused this one, e.g. buffered values
+	Links []SpanContext `json:"links,omitempty"`
+	Node  string        `json:"node"`
+	// "server" for a handled message, "client" for an outgoing request
+	// and "internal" for work started by the node itself
+	Kind  string    `json:"kind"`
+	Name  string    `json:"name"`
+	Peer  string    `json:"peer,omitempty"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Error string    `json:"error,omitempty"`
+}
+
+type Tracer struct {
+	node *maelstrom.Node
+	dir  string
+	mu   sync.Mutex
+	file *os.File
+	// set if the file couldn't be opened, nothing more gets recorded
+	openErr error
+	// src:msg_id -> span of the message being handled
+	active map[string]SpanContext
+}
+
+type spanKey struct{}
+
+// FromEnv returns a tracer writing to GLOMERS_TRACE_DIR, disabled if unset.
+func FromEnv(n *maelstrom.Node) *Tracer {
+	return New(n, os.Getenv("GLOMERS_TRACE_DIR"))
+}
+
+// New returns a tracer writing spans to <dir>/<node ID>.jsonl, disabled if
+// dir is empty.
+func New(n *maelstrom.Node, dir string) *Tracer {
+	return &Tracer{
+		node:   n,
+		dir:    dir,
+		active: make(map[string]SpanContext)}
+}
+
+func (t *Tracer) Enabled() bool {
+	return t.dir != ""
+}
+
+// Middleware records a server span for every handled message, continuing
+// the trace of the sender or starting a new one for client requests.
+func (t *Tracer) Middleware() middleware.Middleware {
+	return func(typ string, next maelstrom.HandlerFunc) maelstrom.HandlerFunc {
+		if !t.Enabled() {
+			return next
+		}
+
+		return func(msg maelstrom.Message) error {
+			var incoming struct {
+				maelstrom.MessageBody
+				SpanContext
+			}
+			json.Unmarshal(msg.Body, &incoming)
+
+			span := Span{
+				SpanContext: SpanContext{TraceID: incoming.TraceID, SpanID: newID(8)},
+				ParentID:    incoming.SpanID,
+				Node:        t.node.ID(),
+				Kind:        "server",
+				Name:        typ,
+				Peer:        msg.Src,
+				Start:       time.Now()}
+			if span.TraceID == "" {
+				span.TraceID = newID(16)
+			}
+
+			key := fmt.Sprintf("%s:%d", msg.Src, incoming.MsgID)
+			t.mu.Lock()
+			t.active[key] = span.SpanContext
+			t.mu.Unlock()
+
+			err := next(msg)
+
+			t.mu.Lock()
+			delete(t.active, key)
+			t.mu.Unlock()
+
+			t.finish(span, err)
+			return err
+		}
+	}
+}
+
+// Context returns a context carrying the span of msg while it's being
+// handled. Has to be called from the handler itself, not from goroutines
+// outliving it.
+func (t *Tracer) Context(msg maelstrom.Message) context.Context {
+	ctx := context.Background()
+	if !t.Enabled() {
+		return ctx
+	}
+
+	var body maelstrom.MessageBody
+	json.Unmarshal(msg.Body, &body)
+
+	t.mu.Lock()
+	sc, ok := t.active[fmt.Sprintf("%s:%d", msg.Src, body.MsgID)]
+	t.mu.Unlock()
+
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, spanKey{}, sc)
+}
+
+// Start starts an internal span, e.g. for a periodic flush of buffered
+// values, with links to the spans that contributed to it. The returned
+// function ends the span.
+func (t *Tracer) Start(ctx context.Context, name string, links ...SpanContext) (context.Context, func()) {
+	if !t.Enabled() {
+		return ctx, func() {}
+	}
+
+	parent, _ := ctx.Value(spanKey{}).(SpanContext)
+	span := Span{
+		SpanContext: SpanContext{TraceID: parent.TraceID, SpanID: newID(8)},
+		ParentID:    parent.SpanID,
+		Links:       links,
+		Node:        t.node.ID(),
+		Kind:        "internal",
+		Name:        name,
+		Start:       time.Now()}
+	if span.TraceID == "" {
+		span.TraceID = newID(16)
+	}
+
+	return context.WithValue(ctx, spanKey{}, span.SpanContext), func() {
+		t.finish(span, nil)
+	}
+}
+
+// SpanFromContext returns the span carried by ctx, if any.
+func SpanFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanKey{}).(SpanContext)
+	return sc, ok
+}
+
+// Send is node.Send within the span carried by ctx.
+func (t *Tracer) Send(ctx context.Context, dest string, body any) error {
+	body, span, err := t.inject(ctx, dest, body)
+	if err != nil {
+		return err
+	}
+	err = t.node.Send(dest, body)
+	t.finish(span, err)
+	return err
+}
+
+// RPC is node.RPC within the span carried by ctx. The span ends once the
+// request is sent.
+func (t *Tracer) RPC(ctx context.Context, dest string, body any, handler maelstrom.HandlerFunc) error {
+	body, span, err := t.inject(ctx, dest, body)
+	if err != nil {
+		return err
+	}
+	err = t.node.RPC(dest, body, handler)
+	t.finish(span, err)
+	return err
+}
+
+// SyncRPC is api.SyncRPC within the span carried by ctx. The span ends
+// once the response arrives or ctx is done.
+func (t *Tracer) SyncRPC(ctx context.Context, dest string, body any) (maelstrom.Message, error) {
+	body, span, err := t.inject(ctx, dest, body)
+	if err != nil {
+		return maelstrom.Message{}, err
+	}
+	res, err := api.SyncRPC(ctx, t.node, dest, body)
+	t.finish(span, err)
+	return res, err
+}
+
+// inject starts a client span and adds its IDs to body.
+func (t *Tracer) inject(ctx context.Context, dest string, body any) (any, Span, error) {
+	if !t.Enabled() {
+		return body, Span{}, nil
+	}
+
+	b := make(map[string]any)
+	if buf, err := json.Marshal(body); err != nil {
+		return nil, Span{}, err
+	} else if err := json.Unmarshal(buf, &b); err != nil {
+		return nil, Span{}, err
+	}
+
+	parent, _ := ctx.Value(spanKey{}).(SpanContext)
+	typ, _ := b["type"].(string)
+	span := Span{
+		SpanContext: SpanContext{TraceID: parent.TraceID, SpanID: newID(8)},
+		ParentID:    parent.SpanID,
+		Node:        t.node.ID(),
+		Kind:        "client",
+		Name:        typ,
+		Peer:        dest,
+		Start:       time.Now()}
+	if span.TraceID == "" {
+		span.TraceID = newID(16)
+	}
+
+	b["trace_id"] = span.TraceID
+	b["span_id"] = span.SpanID
+	return b, span, nil
+}
+
+func (t *Tracer) finish(span Span, err error) {
+	if !t.Enabled() {
+		return
+	}
+
+	span.End = time.Now()
+	if err != nil {
+		span.Error = err.Error()
+	}
+
+	buf, err := json.Marshal(span)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// the node ID is only known after init
+	if t.file == nil && t.openErr == nil {
+		path := filepath.Join(t.dir, t.node.ID()+".jsonl")
+		if t.file, t.openErr = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); t.openErr != nil {
+			log.Println(t.openErr.Error())
+		}
+	}
+	if t.file == nil {
+		return
+	}
+	t.file.Write(append(buf, '\n'))
+}
+
+func newID(size int) string {
+	buf := make([]byte, size)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
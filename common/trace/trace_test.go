@@ -0,0 +1,108 @@
+//go:build go1.25
+
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"common/middleware"
+	"common/sim"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+func readSpans(t *testing.T, path string) []Span {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var spans []Span
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var span Span
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatal(err)
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// TestStitch sends a client request to n0, which asks n1, and checks that
+// the spans of both nodes form a single trace through their parent IDs.
+func TestStitch(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		dir := t.TempDir()
+		nw := sim.New(sim.Config{
+			Seed:    1,
+			Latency: sim.Latency{Base: time.Millisecond},
+			Wait:    synctest.Wait})
+		for _, id := range []string{"n0", "n1"} {
+			n := maelstrom.NewNode()
+			tr := New(n, dir)
+			mux := middleware.New(n, tr.Middleware())
+			mux.Handle("relay", func(msg maelstrom.Message) error {
+				if _, err := tr.SyncRPC(tr.Context(msg), "n1", maelstrom.MessageBody{
+					Type: "echo"}); err != nil {
+					return err
+				}
+				return n.Reply(msg, maelstrom.MessageBody{
+					Type: "relay_ok"})
+			})
+			mux.Handle("echo", func(msg maelstrom.Message) error {
+				return n.Reply(msg, maelstrom.MessageBody{
+					Type: "echo_ok"})
+			})
+			nw.AddNode(id, n)
+		}
+		if err := nw.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer nw.Close()
+
+		if _, err := nw.Client().Call("n0", maelstrom.MessageBody{
+			Type: "relay"}, time.Second); err != nil {
+			t.Fatal(err)
+		}
+
+		n0 := readSpans(t, filepath.Join(dir, "n0.jsonl"))
+		n1 := readSpans(t, filepath.Join(dir, "n1.jsonl"))
+		if len(n0) != 2 || len(n1) != 1 {
+			t.Fatalf("%d spans on n0 and %d on n1, want 2 and 1", len(n0), len(n1))
+		}
+		// the client span ends first
+		client, server, remote := n0[0], n0[1], n1[0]
+
+		if server.Kind != "server" || server.Name != "relay" || server.ParentID != "" || server.Peer != "c1" {
+			t.Errorf("relay span %+v, want a root server span from c1", server)
+		}
+		if client.Kind != "client" || client.Name != "echo" || client.Peer != "n1" || client.ParentID != server.SpanID {
+			t.Errorf("echo client span %+v, want a child of the relay span %s", client, server.SpanID)
+		}
+		if remote.Kind != "server" || remote.Name != "echo" || remote.Peer != "n0" || remote.ParentID != client.SpanID {
+			t.Errorf("echo server span %+v, want a child of the client span %s", remote, client.SpanID)
+		}
+		for _, span := range []Span{client, remote} {
+			if span.TraceID != server.TraceID {
+				t.Errorf("%s span of %s in trace %s, want %s", span.Kind, span.Node, span.TraceID, server.TraceID)
+			}
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"sync"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// Client sends requests to the cluster through one of its nodes.
+type Client struct {
+	id      string
+	conn    *conn
+	mu      sync.Mutex
+	nextID  int
+	pending map[int]chan maelstrom.Message
+}
+
+// Dial connects to the node listening on addr as the client with the given
+// ID, which mustn't be a node ID or SeedID.
+func Dial(addr, id string) (*Client, error) {
+	network, address, err := splitAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	nc, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		id:      id,
+		conn:    &conn{c: nc},
+		pending: make(map[int]chan maelstrom.Message)}
+	go c.read()
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.c.Close()
+}
+
+// Call sends body to dest and waits for the reply. An error reply is
+// returned as an *maelstrom.RPCError.
+func (c *Client) Call(ctx context.Context, dest string, body map[string]any) (maelstrom.Message, error) {
+	ch := make(chan maelstrom.Message, 1)
+
+	c.mu.Lock()
+	c.nextID++
+	msgID := c.nextID
+	c.pending[msgID] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, msgID)
+		c.mu.Unlock()
+	}()
+
+	body["msg_id"] = msgID
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return maelstrom.Message{}, err
+	}
+	line, err := json.Marshal(maelstrom.Message{
+		Src:  c.id,
+		Dest: dest,
+		Body: buf})
+	if err != nil {
+		return maelstrom.Message{}, err
+	}
+	if err := c.conn.write(line); err != nil {
+		return maelstrom.Message{}, err
+	}
+
+	select {
+	case msg := <-ch:
+		if msg.Type() == "error" {
+			var rpcErr maelstrom.RPCError
+			if err := json.Unmarshal(msg.Body, &rpcErr); err != nil {
+				return msg, err
+			}
+			return msg, &rpcErr
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return maelstrom.Message{}, ctx.Err()
+	}
+}
+
+func (c *Client) read() {
+	scanner := bufio.NewScanner(c.conn.c)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var msg maelstrom.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Printf("transport: %s", err)
+			continue
+		}
+		var body maelstrom.MessageBody
+		if err := json.Unmarshal(msg.Body, &body); err != nil {
+			log.Printf("transport: %s", err)
+			continue
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[body.InReplyTo]
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+}
@@ -0,0 +1,339 @@
+// Package transport runs a node as a member of a standalone cluster: instead
+// of Maelstrom's stdin and stdout, the node talks to its peers over TCP or
+// Unix sockets, with the same JSON-lines message envelope.
+//
+// Every process is given its own node ID and the addresses of all nodes.
+// It seeds its node with an init message, dials peers as messages for them
+// come up and accepts connections from peers and clients. A client may
+// connect to any node and send to any other, replies find their way back
+// over the connections the requests came in through. The process of the
+// first node also hosts lin-kv and seq-kv.
+package transport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"common/kvstore"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// SeedID is the source of the init message, replies to it are dropped.
+const SeedID = "c0"
+
+// messages waiting for a peer beyond which new ones are dropped
+const queueSize = 1024
+
+// Peer is a node of the cluster and its address, "tcp:host:port" or
+// "unix:/path".
+type Peer struct {
+	ID   string
+	Addr string
+}
+
+type Transport struct {
+	self  string
+	peers []Peer
+	// node or service ID -> address
+	addrs map[string]string
+	// the node's stdin
+	inbox *io.PipeWriter
+	mu    sync.Mutex
+	// address -> messages waiting to be sent there
+	queues map[string]chan []byte
+	// client ID -> connection its last request came in through
+	clients map[string]*conn
+	// service ID -> stdin of the service hosted by this process
+	services map[string]*io.PipeWriter
+}
+
+type conn struct {
+	mu sync.Mutex
+	c  net.Conn
+}
+
+func (c *conn) write(line []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.c.Write(append(line, '\n'))
+	return err
+}
+
+// FromEnv connects n to the cluster described by GLOMERS_TRANSPORT_CLUSTER,
+// e.g. "n0=tcp:127.0.0.1:7000,n1=unix:/tmp/n1.sock", as the node named by
+// GLOMERS_TRANSPORT_NODE. Does nothing if they're unset, so n keeps talking
+// to Maelstrom. Must be called before anything else wraps the node's
+// streams, e.g. metrics.New.
+func FromEnv(n *maelstrom.Node) error {
+	self, cluster := os.Getenv("GLOMERS_TRANSPORT_NODE"), os.Getenv("GLOMERS_TRANSPORT_CLUSTER")
+	if self == "" && cluster == "" {
+		return nil
+	}
+
+	peers, err := ParseCluster(cluster)
+	if err != nil {
+		return err
+	}
+	_, err = Start(n, self, peers)
+	return err
+}
+
+// ParseCluster parses a comma-separated list of id=addr pairs.
+func ParseCluster(s string) ([]Peer, error) {
+	var peers []Peer
+	for _, pair := range strings.Split(s, ",") {
+		id, addr, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("transport: invalid peer %q", pair)
+		}
+		if _, _, err := splitAddr(addr); err != nil {
+			return nil, err
+		}
+		peers = append(peers, Peer{ID: id, Addr: addr})
+	}
+	return peers, nil
+}
+
+func splitAddr(addr string) (string, string, error) {
+	network, address, ok := strings.Cut(addr, ":")
+	if !ok || (network != "tcp" && network != "unix") {
+		return "", "", fmt.Errorf("transport: invalid address %q, want tcp:host:port or unix:/path", addr)
+	}
+	return network, address, nil
+}
+
+// Start listens on the address of self, replaces the streams of n and
+// seeds it with an init message. n must not be running yet.
+func Start(n *maelstrom.Node, self string, peers []Peer) (*Transport, error) {
+	t := &Transport{
+		self:     self,
+		peers:    peers,
+		addrs:    make(map[string]string),
+		queues:   make(map[string]chan []byte),
+		clients:  make(map[string]*conn),
+		services: make(map[string]*io.PipeWriter)}
+
+	for _, p := range peers {
+		t.addrs[p.ID] = p.Addr
+	}
+	addr, ok := t.addrs[self]
+	if !ok {
+		return nil, fmt.Errorf("transport: %s is not in the cluster", self)
+	}
+	// services live with the first node
+	for _, id := range []string{maelstrom.LinKV, maelstrom.SeqKV} {
+		t.addrs[id] = peers[0].Addr
+	}
+
+	network, address, _ := splitAddr(addr)
+	if network == "unix" {
+		os.Remove(address)
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	go t.accept(l)
+
+	if self == peers[0].ID {
+		t.hostService(kvstore.NewLinKV())
+		t.hostService(kvstore.NewSeqKV(0, 0))
+	}
+
+	stdin, inbox := io.Pipe()
+	t.inbox = inbox
+	n.Stdin = stdin
+	n.Stdout = &outbox{t: t}
+
+	go t.seed()
+	return t, nil
+}
+
+func (t *Transport) seed() {
+	ids := make([]string, len(t.peers))
+	for i, p := range t.peers {
+		ids[i] = p.ID
+	}
+
+	body, _ := json.Marshal(map[string]any{
+		"type":     "init",
+		"msg_id":   1,
+		"node_id":  t.self,
+		"node_ids": ids})
+	line, _ := json.Marshal(maelstrom.Message{
+		Src:  SeedID,
+		Dest: t.self,
+		Body: body})
+	t.inbox.Write(append(line, '\n'))
+}
+
+func (t *Transport) hostService(s *kvstore.Store) {
+	n := s.Node()
+	n.Init(s.ID(), nil)
+
+	stdin, w := io.Pipe()
+	n.Stdin = stdin
+	n.Stdout = &outbox{t: t}
+
+	t.mu.Lock()
+	t.services[s.ID()] = w
+	t.mu.Unlock()
+
+	go func() {
+		if err := n.Run(); err != nil {
+			log.Printf("transport: %s: %s", s.ID(), err)
+		}
+	}()
+}
+
+func (t *Transport) accept(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			log.Printf("transport: %s", err)
+			return
+		}
+		go t.read(&conn{c: c})
+	}
+}
+
+// read routes every message coming in through c, remembering c as the way
+// back to clients.
+func (t *Transport) read(c *conn) {
+	scanner := bufio.NewScanner(c.c)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := bytes.Clone(scanner.Bytes())
+
+		var msg maelstrom.Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			log.Printf("transport: %s", err)
+			continue
+		}
+
+		if _, ok := t.addrs[msg.Src]; !ok {
+			t.mu.Lock()
+			t.clients[msg.Src] = c
+			t.mu.Unlock()
+		}
+		t.route(msg.Dest, line)
+	}
+	c.c.Close()
+}
+
+// route delivers a message, dropping it if the destination can't be
+// reached, same as a lossy network.
+func (t *Transport) route(dest string, line []byte) {
+	if dest == t.self {
+		t.inbox.Write(append(line, '\n'))
+		return
+	}
+	if dest == SeedID {
+		return
+	}
+
+	t.mu.Lock()
+	service, isService := t.services[dest]
+	client, isClient := t.clients[dest]
+	t.mu.Unlock()
+
+	var err error
+	switch addr, isPeer := t.addrs[dest]; {
+	case isService:
+		_, err = service.Write(append(line, '\n'))
+	case isPeer:
+		err = t.send(addr, line)
+	case isClient:
+		err = client.write(line)
+	default:
+		err = fmt.Errorf("unknown destination")
+	}
+	if err != nil {
+		log.Printf("transport: dropped message to %s: %s", dest, err)
+	}
+}
+
+// send queues a message for the peer at addr, dropping it if the queue is
+// full. Messages are sent by a goroutine per address, so that a peer that
+// is slow to dial or to read doesn't hold up the node's other messages.
+func (t *Transport) send(addr string, line []byte) error {
+	t.mu.Lock()
+	q, ok := t.queues[addr]
+	if !ok {
+		q = make(chan []byte, queueSize)
+		t.queues[addr] = q
+		go t.sendLoop(addr, q)
+	}
+	t.mu.Unlock()
+
+	select {
+	case q <- line:
+		return nil
+	default:
+		return fmt.Errorf("queue full")
+	}
+}
+
+// sendLoop writes the messages queued for addr, dialing it as needed.
+func (t *Transport) sendLoop(addr string, q chan []byte) {
+	var c *conn
+	for line := range q {
+		if c == nil {
+			network, address, _ := splitAddr(addr)
+			nc, err := net.Dial(network, address)
+			if err != nil {
+				log.Printf("transport: dropped message to %s: %s", addr, err)
+				continue
+			}
+			c = &conn{c: nc}
+			// replies to clients come back through here
+			go t.read(c)
+		}
+
+		if err := c.write(line); err != nil {
+			log.Printf("transport: dropped message to %s: %s", addr, err)
+			// redial next time
+			c.c.Close()
+			c = nil
+		}
+	}
+}
+
+// outbox splits what a node writes into messages and routes them. The node
+// serializes its writes, so it needs no locking.
+type outbox struct {
+	t   *Transport
+	buf []byte
+}
+
+func (o *outbox) Write(p []byte) (int, error) {
+	o.buf = append(o.buf, p...)
+	for {
+		i := bytes.IndexByte(o.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+
+		line := bytes.Clone(o.buf[:i])
+		o.buf = o.buf[i+1:]
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var msg maelstrom.Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			log.Printf("transport: %s", err)
+			continue
+		}
+		o.t.route(msg.Dest, line)
+	}
+}
@@ -0,0 +1,144 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// the nodes log every message
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// freePort returns a TCP address on loopback nothing listens on.
+func freePort(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return "tcp:" + l.Addr().String()
+}
+
+// TestLoopback runs n0 over TCP and n1 and n2 over Unix sockets. n1
+// relays to n2 and uses lin-kv and seq-kv, which the process of n0 hosts.
+func TestLoopback(t *testing.T) {
+	dir := t.TempDir()
+	peers := []Peer{
+		{ID: "n0", Addr: freePort(t)},
+		{ID: "n1", Addr: "unix:" + filepath.Join(dir, "n1.sock")},
+		{ID: "n2", Addr: "unix:" + filepath.Join(dir, "n2.sock")}}
+
+	for _, p := range peers {
+		n := maelstrom.NewNode()
+		n.Handle("echo", func(msg maelstrom.Message) error {
+			var body map[string]any
+			if err := json.Unmarshal(msg.Body, &body); err != nil {
+				return err
+			}
+			body["type"] = "echo_ok"
+			body["node"] = n.ID()
+			return n.Reply(msg, body)
+		})
+		n.Handle("relay", func(msg maelstrom.Message) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			reply, err := n.SyncRPC(ctx, "n2", map[string]any{
+				"type": "echo"})
+			if err != nil {
+				return err
+			}
+			return n.Reply(msg, map[string]any{
+				"type":  "relay_ok",
+				"reply": reply.Body})
+		})
+		n.Handle("kv", func(msg maelstrom.Message) error {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			values := make(map[string]int)
+			for _, id := range []string{maelstrom.LinKV, maelstrom.SeqKV} {
+				kv := maelstrom.NewKV(id, n)
+				if err := kv.Write(ctx, "x", 5); err != nil {
+					return err
+				}
+				v, err := kv.ReadInt(ctx, "x")
+				if err != nil {
+					return err
+				}
+				values[id] = v
+			}
+			return n.Reply(msg, map[string]any{
+				"type":   "kv_ok",
+				"values": values})
+		})
+		if _, err := Start(n, p.ID, peers); err != nil {
+			t.Fatal(err)
+		}
+		go n.Run()
+	}
+
+	c, err := Dial(peers[0].Addr, "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	call := func(dest string, body map[string]any) map[string]any {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		reply, err := c.Call(ctx, dest, body)
+		if err != nil {
+			t.Fatalf("%s to %s: %s", body["type"], dest, err)
+		}
+		var res map[string]any
+		if err := json.Unmarshal(reply.Body, &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	// n0 may not have its init message yet
+	deadline := time.Now().Add(10 * time.Second)
+	for _, id := range []string{"n0", "n1", "n2"} {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			reply, err := c.Call(ctx, id, map[string]any{"type": "echo", "echo": id})
+			cancel()
+			if err == nil {
+				var body map[string]any
+				json.Unmarshal(reply.Body, &body)
+				if body["node"] != id || body["echo"] != id {
+					t.Errorf("echo from %s: %v", id, body)
+				}
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("no echo from %s: %s", id, err)
+			}
+		}
+	}
+
+	relayed := call("n1", map[string]any{"type": "relay"})
+	if reply, _ := relayed["reply"].(map[string]any); reply["node"] != "n2" {
+		t.Errorf("relay through n1 got %v, want a reply from n2", relayed)
+	}
+
+	got := call("n1", map[string]any{"type": "kv"})
+	values, _ := got["values"].(map[string]any)
+	for _, id := range []string{maelstrom.LinKV, maelstrom.SeqKV} {
+		if v := values[id]; v != 5.0 {
+			t.Errorf("%s read %v, want 5", id, v)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package wire observes the messages a node reads and writes, by tapping
+// its Stdin and Stdout.
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// OnReceive calls fn for every message n reads. Must be called before Run.
+func OnReceive(n *maelstrom.Node, fn func(maelstrom.Message)) {
+	n.Stdin = &tapReader{r: n.Stdin, tap: tap{fn: decode(fn)}}
+}
+
+// OnSend calls fn for every message n writes. Must be called before Run.
+func OnSend(n *maelstrom.Node, fn func(maelstrom.Message)) {
+	n.Stdout = &tapWriter{w: n.Stdout, tap: tap{fn: decode(fn)}}
+}
+
+func decode(fn func(maelstrom.Message)) func([]byte) {
+	return func(line []byte) {
+		var msg maelstrom.Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			log.Printf("wire: %s", err)
+			return
+		}
+		fn(msg)
+	}
+}
+
+// tap splits a stream of bytes into lines. The line passed to fn is only
+// valid during the call.
+type tap struct {
+	fn  func([]byte)
+	buf []byte
+}
+
+func (t *tap) scan(p []byte) {
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			t.buf = append(t.buf, p...)
+			return
+		}
+
+		line := p[:i]
+		if len(t.buf) > 0 {
+			t.buf = append(t.buf, line...)
+			line = t.buf
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			t.fn(line)
+		}
+		t.buf = t.buf[:0]
+		p = p[i+1:]
+	}
+}
+
+type tapReader struct {
+	r io.Reader
+	tap
+}
+
+func (t *tapReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.scan(p[:n])
+	return n, err
+}
+
+// The node serializes its writes, so the writer needs no locking.
+type tapWriter struct {
+	w io.Writer
+	tap
+}
+
+func (t *tapWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.scan(p[:n])
+	return n, err
+}
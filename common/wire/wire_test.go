@@ -0,0 +1,106 @@
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+func TestMain(m *testing.M) {
+	// malformed lines are logged
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+const stream = `{"src": "c1", "dest": "n0", "body": {"type": "echo", "msg_id": 1}}
+{"src": "n1", "dest": "n0", "body": {"type": "gossip", "values": [1, 2, 3]}}
+
+not json
+{"src": "c2", "dest": "n0", "body": {"type": "read", "msg_id": 2}}
+`
+
+// chunks splits s into pieces of size n, the last one shorter.
+func chunks(s string, n int) []string {
+	var res []string
+	for len(s) > n {
+		res = append(res, s[:n])
+		s = s[n:]
+	}
+	return append(res, s)
+}
+
+// readers returns a reader per chunk, so that each read gets at most one.
+func readers(chunks []string) []io.Reader {
+	var res []io.Reader
+	for _, chunk := range chunks {
+		res = append(res, strings.NewReader(chunk))
+	}
+	return res
+}
+
+func describe(msgs []maelstrom.Message) []string {
+	var res []string
+	for _, msg := range msgs {
+		res = append(res, fmt.Sprintf("%s>%s %s", msg.Src, msg.Dest, msg.Type()))
+	}
+	return res
+}
+
+var want = []string{"c1>n0 echo", "n1>n0 gossip", "c2>n0 read"}
+
+func TestOnSend(t *testing.T) {
+	for _, size := range []int{1, 7, 64, len(stream)} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			n := maelstrom.NewNode()
+			var out bytes.Buffer
+			n.Stdout = &out
+			var got []maelstrom.Message
+			OnSend(n, func(msg maelstrom.Message) {
+				got = append(got, msg)
+			})
+
+			for _, chunk := range chunks(stream, size) {
+				if _, err := io.WriteString(n.Stdout, chunk); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if out.String() != stream {
+				t.Errorf("wrote %q, want %q", out.String(), stream)
+			}
+			if d := describe(got); !slices.Equal(d, want) {
+				t.Errorf("tapped %v, want %v", d, want)
+			}
+		})
+	}
+}
+
+func TestOnReceive(t *testing.T) {
+	for _, size := range []int{1, 7, 64, len(stream)} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			n := maelstrom.NewNode()
+			n.Stdin = io.MultiReader(readers(chunks(stream, size))...)
+			var got []maelstrom.Message
+			OnReceive(n, func(msg maelstrom.Message) {
+				got = append(got, msg)
+			})
+
+			buf, err := io.ReadAll(n.Stdin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != stream {
+				t.Errorf("read %q, want %q", buf, stream)
+			}
+			if d := describe(got); !slices.Equal(d, want) {
+				t.Errorf("tapped %v, want %v", d, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Package workload runs the client side of Maelstrom's workloads against
+// the nodes of a simulated network step by step, so that a run only
+// depends on its seed and the results can be checked by tests.
+package workload
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"common/api"
+	"common/checker"
+	"common/sim"
+
+	maelstrom "github.com/jepsen-io/maelstrom/demo/go"
+)
+
+// timeout of the requests the workloads wait for
+const timeout = 10 * time.Second
+
+// Broadcast sends a topology to every node, then broadcasts and reads at
+// random nodes at a fixed rate, without waiting for the previous requests
+// to be answered, and finally reads from every node.
+type Broadcast struct {
+	// topology sent to the nodes, Grid of them if nil
+	Topology map[string][]string
+	// number of operations, about half of them broadcasts
+	Ops int
+	// virtual time between the starts of two operations
+	Interval time.Duration
+	// virtual time between the last operation and the final reads, during
+	// which the nodes are read from in turns, so that the latency of the
+	// values broadcast last is measured by reads rather than by the wait
+	FinalWait time.Duration
+	Seed      uint64
+}
+
+// Run runs the workload against the cluster members of nw, which has to
+// be started, and returns the history.
+func (b Broadcast) Run(nw *sim.Network) (checker.BroadcastHistory, error) {
+	nodes := nw.NodeIDs()
+	h := checker.BroadcastHistory{
+		Nodes: nodes}
+	topology := b.Topology
+	if topology == nil {
+		topology = Grid(nodes)
+	}
+
+	c := nw.Client()
+	for _, node := range nodes {
+		reqBody := api.Topology{
+			MessageBody: maelstrom.MessageBody{Type: "topology"},
+			Topology:    topology}
+		if _, err := c.Call(node, reqBody, timeout); err != nil {
+			return h, fmt.Errorf("topology %s: %w", node, err)
+		}
+	}
+
+	var mu sync.Mutex
+	nw.Observe(func(d sim.Delivery) {
+		mu.Lock()
+		h.Messages = append(h.Messages, checker.Message{Src: d.Msg.Src, Dest: d.Msg.Dest, At: d.At})
+		mu.Unlock()
+	})
+
+	var ops []*checker.BroadcastOp
+	pending := 0
+	// invoke is called by the network, one at a time
+	invoke := func(node string, op *checker.BroadcastOp) {
+		var reqBody any = api.Read{
+			MessageBody: maelstrom.MessageBody{Type: "read"}}
+		if op.F == "broadcast" {
+			reqBody = api.Broadcast{
+				MessageBody: maelstrom.MessageBody{Type: "broadcast"},
+				Message:     &op.Value}
+		}
+
+		mu.Lock()
+		op.Node = node
+		op.Invoke = nw.Now()
+		ops = append(ops, op)
+		pending++
+		mu.Unlock()
+
+		c.Go(node, reqBody, func(res maelstrom.Message, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			pending--
+			op.Complete = nw.Now()
+			op.OK = err == nil
+			if err == nil && op.F == "read" {
+				resBody, err := api.Decode[api.ReadOK](res)
+				op.Read = resBody.Messages
+				op.OK = err == nil
+			}
+		})
+	}
+	read := func(node string) func(*sim.Network) {
+		return func(*sim.Network) {
+			invoke(node, &checker.BroadcastOp{
+				F: "read"})
+		}
+	}
+
+	rng := rand.New(rand.NewPCG(b.Seed, b.Seed))
+	start := nw.Now()
+	for i := range b.Ops {
+		at := start + time.Duration(i)*b.Interval
+		node := nodes[rng.IntN(len(nodes))]
+		if rng.IntN(2) == 0 {
+			nw.At(at, read(node))
+			continue
+		}
+		value := float64(i)
+		nw.At(at, func(*sim.Network) {
+			invoke(node, &checker.BroadcastOp{
+				F:     "broadcast",
+				Value: value})
+		})
+	}
+	end := start + time.Duration(b.Ops)*b.Interval
+	for i := 0; b.Interval > 0 && time.Duration(i)*b.Interval < b.FinalWait; i++ {
+		nw.At(end+time.Duration(i)*b.Interval, read(nodes[i%len(nodes)]))
+	}
+	nw.Advance(end + b.FinalWait - nw.Now())
+
+	for _, node := range nodes {
+		read(node)(nw)
+	}
+	deadline := nw.Now() + timeout
+	for nw.Now() < deadline {
+		mu.Lock()
+		done := pending == 0
+		mu.Unlock()
+		if done || !nw.Step() {
+			break
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, op := range ops {
+		h.Ops = append(h.Ops, *op)
+	}
+	if pending > 0 {
+		return h, fmt.Errorf("%d requests unanswered", pending)
+	}
+	return h, nil
+}
+
+// Grid arranges the nodes in a square grid and connects each to its
+// neighbours, like Maelstrom's default topology.
+func Grid(nodes []string) map[string][]string {
+	width := int(math.Ceil(math.Sqrt(float64(len(nodes)))))
+	topology := make(map[string][]string)
+	for i, node := range nodes {
+		neighbours := []string{}
+		if i%width > 0 {
+			neighbours = append(neighbours, nodes[i-1])
+		}
+		if i%width < width-1 && i+1 < len(nodes) {
+			neighbours = append(neighbours, nodes[i+1])
+		}
+		if i-width >= 0 {
+			neighbours = append(neighbours, nodes[i-width])
+		}
+		if i+width < len(nodes) {
+			neighbours = append(neighbours, nodes[i+width])
+		}
+		topology[node] = neighbours
+	}
+	return topology
+}